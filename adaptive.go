@@ -0,0 +1,82 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// adaptive is the AIMD state of an adaptive limiter.
+type adaptive struct {
+	max      int
+	min      int
+	target   time.Duration
+	increase int
+	decrease float64
+	current  int
+	lock     sync.Mutex
+}
+
+func newAdaptive(opts *Options) *adaptive {
+	a := &adaptive{
+		max:      opts.Max,
+		min:      opts.AdaptiveMin,
+		target:   opts.AdaptiveLatencyTarget,
+		increase: opts.AdaptiveIncrease,
+		decrease: opts.AdaptiveDecrease,
+		current:  opts.Max,
+	}
+	if a.min <= 0 {
+		a.min = 1
+	}
+	if a.min > a.max {
+		a.min = a.max
+	}
+	if a.increase <= 0 {
+		a.increase = 1
+	}
+	if a.decrease <= 0 || a.decrease >= 1 {
+		a.decrease = 0.5
+	}
+	return a
+}
+
+func (a *adaptive) report(latency time.Duration) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if latency > a.target {
+		a.current = int(float64(a.current) * a.decrease)
+		if a.current < a.min {
+			a.current = a.min
+		}
+	} else {
+		a.current += a.increase
+		if a.current > a.max {
+			a.current = a.max
+		}
+	}
+}
+
+func (a *adaptive) effectiveMax() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.current
+}
+
+// ReportLatency feeds a latency of the protected downstream to an adaptive limiter
+// (see Options.AdaptiveLatencyTarget), it does nothing for other limiters.
+// A latency over the target decreases the effective max count multiplicatively,
+// others increase it additively back to Options.Max.
+func (l *Limiter) ReportLatency(latency time.Duration) {
+	if l.adaptive != nil {
+		l.adaptive.report(latency)
+	}
+}
+
+// EffectiveMax returns the max count that Get without policy uses for new windows,
+// it is Options.Max if the limiter is not adaptive.
+func (l *Limiter) EffectiveMax() int {
+	if l.adaptive != nil {
+		return l.adaptive.effectiveMax()
+	}
+	return l.max
+}
@@ -0,0 +1,76 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptive(t *testing.T) {
+	t.Run("limiter with AdaptiveLatencyTarget should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{
+			Max:                   100,
+			Duration:              50 * time.Millisecond,
+			AdaptiveLatencyTarget: 100 * time.Millisecond,
+			AdaptiveIncrease:      10,
+			AdaptiveMin:           10,
+		})
+		id := genID()
+		assert.Equal(100, limiter.EffectiveMax())
+
+		// sustained high latency
+		limiter.ReportLatency(200 * time.Millisecond)
+		assert.Equal(50, limiter.EffectiveMax())
+		for i := 0; i < 5; i++ {
+			limiter.ReportLatency(200 * time.Millisecond)
+		}
+		assert.Equal(10, limiter.EffectiveMax())
+
+		res, err := limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(10, res.Total)
+		assert.Equal(9, res.Remaining)
+		res, _ = limiter.Get(id, 20, 1000)
+		assert.Equal(10, res.Total)
+
+		// recovery
+		for i := 0; i < 5; i++ {
+			limiter.ReportLatency(50 * time.Millisecond)
+		}
+		assert.Equal(60, limiter.EffectiveMax())
+		for i := 0; i < 10; i++ {
+			limiter.ReportLatency(100 * time.Millisecond)
+		}
+		assert.Equal(100, limiter.EffectiveMax())
+
+		// the live window keeps its total
+		res, _ = limiter.Get(id)
+		assert.Equal(10, res.Total)
+		time.Sleep(60 * time.Millisecond)
+		res, _ = limiter.Get(id)
+		assert.Equal(100, res.Total)
+		assert.Equal(99, res.Remaining)
+	})
+
+	t.Run("limiter without AdaptiveLatencyTarget should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 10})
+		limiter.ReportLatency(time.Hour)
+		assert.Equal(10, limiter.EffectiveMax())
+		res, _ := limiter.Get(genID())
+		assert.Equal(10, res.Total)
+	})
+
+	t.Run("newAdaptive with invalid options should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		a := newAdaptive(&Options{Max: 5, AdaptiveMin: 10, AdaptiveDecrease: 2})
+		assert.Equal(5, a.min)
+		assert.Equal(1, a.increase)
+		assert.Equal(0.5, a.decrease)
+	})
+}
@@ -3,7 +3,9 @@ package ratelimiter_test
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	ratelimiter "github.com/teambition/ratelimiter-go"
 )
@@ -21,6 +23,37 @@ func BenchmarkGet(b *testing.B) {
 		limiter.Get(id, policy...)
 	}
 }
+
+// BenchmarkMemoryHotKey compares the Get of one key under the limiter lock with a bare atomic
+// decrement and expire check, the floor of a lock-free hit path that keeps no stats and no status.
+func BenchmarkMemoryHotKey(b *testing.B) {
+	b.Run("lock", func(b *testing.B) {
+		limiter := ratelimiter.New(ratelimiter.Options{DisableBackgroundCleanup: true})
+		id := getUniqueID()
+		policy := []int{1 << 30, 60000}
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				limiter.Get(id, policy...)
+			}
+		})
+	})
+
+	b.Run("atomic", func(b *testing.B) {
+		remaining := int64(1 << 30)
+		expire := time.Now().Add(time.Minute).UnixNano()
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if atomic.LoadInt64(&expire) > time.Now().UnixNano() {
+					atomic.AddInt64(&remaining, -1)
+				}
+			}
+		})
+	})
+}
 func BenchmarkGetAndEexceeding(b *testing.B) {
 
 	limiter := ratelimiter.New(ratelimiter.Options{})
@@ -0,0 +1,126 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// BlockEntry is an id and its penalty for Limiter.BlockMany.
+type BlockEntry struct {
+	ID      string
+	Penalty time.Duration
+}
+
+// BlockError is returned by BlockMany if redis fails in the middle of the entries.
+type BlockError struct {
+	Blocked []string // The ids blocked before the error, in the order of the entries.
+	Err     error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("ratelimiter: %d ids blocked before error: %v", len(e.Blocked), e.Err)
+}
+
+type blocker interface {
+	// block blocks the keys in order, and returns the count of blocked keys.
+	block(keys []string, penalties []time.Duration) (int, error)
+}
+
+// Block denies all requests of id for penalty, whatever the remaining of its current window.
+// The blocked window keeps its total, its duration is penalty and it resets after penalty,
+// so Get returns Remaining -1 with the Reset of the penalty end. Remove unblocks id.
+// It is supported by fixed window limiters only.
+func (l *Limiter) Block(id string, penalty time.Duration) error {
+	err := l.BlockMany([]BlockEntry{{ID: id, Penalty: penalty}})
+	if e, ok := err.(*BlockError); ok {
+		return e.Err
+	}
+	return err
+}
+
+// BlockMany blocks every id of entries for its penalty, see Block.
+// A memory limiter blocks all ids in one locked pass. A redis limiter blocks the ids one by one,
+// because they may be in different slots of redis cluster, and if redis fails in the middle,
+// it stops and returns a *BlockError with the ids blocked before the error.
+func (l *Limiter) BlockMany(entries []BlockEntry) error {
+	b, ok := l.abstractLimiter.(blocker)
+	if !ok {
+		return errors.New("ratelimiter: block is only supported by fixed window limiter")
+	}
+	keys := make([]string, len(entries))
+	penalties := make([]time.Duration, len(entries))
+	for i, entry := range entries {
+		if entry.Penalty < time.Millisecond {
+			return errors.New("ratelimiter: penalty must be at least 1 millisecond")
+		}
+		keys[i] = l.prefix + entry.ID
+		penalties[i] = entry.Penalty
+	}
+
+	if l.serialize {
+		l.serial.Lock()
+		defer l.serial.Unlock()
+	}
+	n, err := b.block(keys, penalties)
+	if err != nil {
+		blocked := make([]string, n)
+		for i := range blocked {
+			blocked[i] = entries[i].ID
+		}
+		return &BlockError{Blocked: blocked, Err: err}
+	}
+	return nil
+}
+
+// blocker interface
+func (m *memoryLimiter) block(keys []string, penalties []time.Duration) (int, error) {
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for i, key := range keys {
+		item, ok := m.store[key]
+		if !ok {
+			item = &limiterCacheItem{total: m.max}
+			m.store[key] = item
+			m.checkHighWaterMark()
+		}
+		item.remaining = -1
+		item.overflow = 0
+		item.duration = penalties[i]
+		item.expire = now.Add(penalties[i])
+	}
+	return len(keys), nil
+}
+
+// blocker interface
+func (r *redisLimiter) block(keys []string, penalties []time.Duration) (int, error) {
+	for i, key := range keys {
+		penalty := strconv.FormatInt(int64(penalties[i]/time.Millisecond), 10)
+		keys := []string{key, fmt.Sprintf("{%s}:F", key)}
+		if _, err := evalScript(r.rc, r.blockSha1, blockLua, keys, genTimestamp(), r.max, penalty); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
+
+const blockLua string = `
+-- KEYS[1] target hash key
+-- KEYS[2] target seen key
+-- ARGV[1] current timestamp, ARGV[2] max count for a new record, ARGV[3] penalty
+
+local now = tonumber(ARGV[1])
+local penalty = tonumber(ARGV[3])
+local total = tonumber(redis.call('hget', KEYS[1], 'lt')) or tonumber(ARGV[2])
+
+redis.call('hmset', KEYS[1], 'ct', -1, 'lt', total, 'dn', penalty, 'rt', now + penalty, 'fw', 0)
+redis.call('hdel', KEYS[1], 'ov')
+redis.call('pexpire', KEYS[1], penalty)
+-- the id is seen as the limit script does, so the window after the penalty is not the first one
+if redis.call('pttl', KEYS[2]) < penalty * 2 then
+  redis.call('set', KEYS[2], 1, 'px', penalty * 2)
+end
+return 1
+`
@@ -0,0 +1,128 @@
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failAfterClient fails every EVALSHA after the first n.
+type failAfterClient struct {
+	*mockRedisClient
+	n int
+}
+
+func (c *failAfterClient) RateEvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	if c.n <= 0 {
+		return nil, errors.New("connection refused")
+	}
+	c.n--
+	return c.mockRedisClient.RateEvalSha(sha1, keys, args...)
+}
+
+func TestMemoryBlock(t *testing.T) {
+	t.Run("limiter.BlockMany should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id1, id2, id3 := genID(), genID(), genID()
+		limiter.Get(id1)
+
+		err := limiter.BlockMany([]BlockEntry{
+			{ID: id1, Penalty: 100 * time.Millisecond},
+			{ID: id2, Penalty: 200 * time.Millisecond},
+		})
+		assert.Nil(err)
+
+		for i := 0; i < 3; i++ {
+			res, err := limiter.Get(id1)
+			assert.Nil(err)
+			assert.Equal(-1, res.Remaining)
+			assert.Equal(100, res.Total)
+			assert.True(res.HardExceeded)
+			res, _ = limiter.Get(id2)
+			assert.Equal(-1, res.Remaining)
+			assert.True(res.Reset.After(time.Now().Add(100 * time.Millisecond)))
+		}
+		res, _ := limiter.Get(id3)
+		assert.Equal(99, res.Remaining)
+
+		time.Sleep(110 * time.Millisecond)
+		res, _ = limiter.Get(id1)
+		assert.Equal(99, res.Remaining)
+		assert.Equal(time.Minute, res.Duration)
+		res, _ = limiter.Get(id2)
+		assert.Equal(-1, res.Remaining)
+
+		time.Sleep(100 * time.Millisecond)
+		res, _ = limiter.Get(id2)
+		assert.Equal(99, res.Remaining)
+	})
+
+	t.Run("limiter.Block should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		assert.Nil(limiter.Block(id, time.Minute))
+		res, _ := limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+
+		assert.Nil(limiter.Remove(id))
+		res, _ = limiter.Get(id)
+		assert.Equal(99, res.Remaining)
+
+		err := limiter.Block(id, 0)
+		assert.Equal("ratelimiter: penalty must be at least 1 millisecond", err.Error())
+
+		limiter = New(Options{Algorithm: SlidingWindow})
+		err = limiter.Block(id, time.Minute)
+		assert.Equal("ratelimiter: block is only supported by fixed window limiter", err.Error())
+	})
+	t.Run("limiter.Block should keep the allowed count", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{WindowHistorySize: 2})
+		id, other := genID(), genID()
+		limiter.Get(id)
+		assert.Nil(limiter.Block(id, 30*time.Millisecond))
+		assert.Nil(limiter.Block(other, 30*time.Millisecond))
+		res, _ := limiter.Get(id)
+		assert.False(res.Allowed())
+		assert.Equal(1, res.Used)
+		res, _ = limiter.Get(other)
+		assert.Equal(0, res.Used)
+
+		// the window after the penalty is not the first one
+		time.Sleep(35 * time.Millisecond)
+		res, _ = limiter.Get(id)
+		assert.Equal(1, res.Used)
+		history, _ := limiter.WindowHistory(id)
+		assert.Equal([]int{1}, history)
+		res, _ = limiter.Get(other)
+		assert.False(res.FirstWindow)
+	})
+}
+
+func TestRedisBlockManyError(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &failAfterClient{mockRedisClient: &mockRedisClient{}, n: 2}
+	limiter := New(Options{Client: client})
+	id1, id2, id3 := genID(), genID(), genID()
+
+	err := limiter.BlockMany([]BlockEntry{
+		{ID: id1, Penalty: time.Minute},
+		{ID: id2, Penalty: time.Minute},
+		{ID: id3, Penalty: time.Minute},
+	})
+	e, ok := err.(*BlockError)
+	assert.True(ok)
+	assert.Equal([]string{id1, id2}, e.Blocked)
+	assert.Equal("connection refused", e.Err.Error())
+	assert.Equal("ratelimiter: 2 ids blocked before error: connection refused", err.Error())
+
+	assert.Equal("connection refused", limiter.Block(id3, time.Minute).Error())
+}
@@ -0,0 +1,135 @@
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a redis limiter when its circuit breaker is open.
+var ErrCircuitOpen = errors.New("ratelimiter: circuit breaker is open")
+
+// BreakerState is the state of the circuit breaker of a redis limiter.
+type BreakerState int
+
+const (
+	// BreakerClosed means requests go to redis.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen means requests fail without calling redis until the cooldown ends.
+	BreakerOpen
+	// BreakerHalfOpen means one request is testing whether redis has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker opens after threshold consecutive errors within window,
+// and lets one request through to test redis after cooldown.
+type breaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	first     time.Time
+	opened    time.Time
+	probing   bool
+	lock      sync.Mutex
+}
+
+func (b *breaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.opened) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) done(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	now := time.Now()
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+		b.opened = now
+		return
+	}
+	if b.failures == 0 || now.Sub(b.first) > b.window {
+		b.failures = 0
+		b.first = now
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.opened = now
+		b.failures = 0
+	}
+}
+
+func (b *breaker) current() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == BreakerOpen && time.Since(b.opened) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// breakerClient guards the script calls of a RedisClient with a breaker.
+type breakerClient struct {
+	RedisClient
+	b *breaker
+}
+
+func (c *breakerClient) RateEvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	if !c.b.allow() {
+		return nil, ErrCircuitOpen
+	}
+	res, err := c.RedisClient.RateEvalSha(sha1, keys, args...)
+	if err != nil && isNoScriptErr(err) {
+		// redis is responding, the script will be reloaded.
+		c.b.done(nil)
+	} else {
+		c.b.done(err)
+	}
+	return res, err
+}
+
+// BreakerState returns the state of the circuit breaker,
+// it is always BreakerClosed for a limiter without circuit breaker.
+func (l *Limiter) BreakerState() BreakerState {
+	if l.breaker == nil {
+		return BreakerClosed
+	}
+	return l.breaker.current()
+}
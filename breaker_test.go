@@ -0,0 +1,171 @@
+package ratelimiter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockRedisClient answers loaded limit scripts with fresh windows, or err if set.
+type mockRedisClient struct {
+	err      error
+	evalSha  int
+	loaded   int
+	scripts  map[string]bool
+	commands []string
+	deleted  []string
+	lock     sync.Mutex
+}
+
+func (c *mockRedisClient) fail(err error) {
+	c.lock.Lock()
+	c.err = err
+	c.lock.Unlock()
+}
+
+func (c *mockRedisClient) RateDel(key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deleted = append(c.deleted, key)
+	return nil
+}
+
+func (c *mockRedisClient) RateEvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.evalSha++
+	c.commands = append(c.commands, "EVALSHA")
+	if c.err != nil {
+		return nil, c.err
+	}
+	if !c.scripts[sha1] {
+		return nil, errors.New("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return []interface{}{int64(9), int64(10), int64(1000), time.Now().Add(time.Second).UnixNano() / 1e6}, nil
+}
+
+func (c *mockRedisClient) RateScriptLoad(script string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.loaded++
+	c.commands = append(c.commands, "SCRIPT LOAD")
+	if c.scripts == nil {
+		c.scripts = make(map[string]bool)
+	}
+	sum := sha1.Sum([]byte(script))
+	sha := hex.EncodeToString(sum[:])
+	c.scripts[sha] = true
+	return sha, nil
+}
+
+func TestRedisCircuitBreaker(t *testing.T) {
+	t.Run("limiter with circuit breaker should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &mockRedisClient{}
+		limiter := New(Options{
+			Client:           client,
+			BreakerThreshold: 3,
+			BreakerCooldown:  50 * time.Millisecond,
+		})
+		id := genID()
+
+		res, err := limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(9, res.Remaining)
+		assert.Equal(BreakerClosed, limiter.BreakerState())
+
+		client.fail(errors.New("connection refused"))
+		for i := 0; i < 3; i++ {
+			_, err = limiter.Get(id)
+			assert.Equal("connection refused", err.Error())
+		}
+		assert.Equal(BreakerOpen, limiter.BreakerState())
+
+		// redis is not called while the breaker is open
+		_, err = limiter.Get(id)
+		assert.Equal(ErrCircuitOpen, err)
+		assert.Equal(4, client.evalSha)
+
+		// a failed test request opens the breaker again
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(BreakerHalfOpen, limiter.BreakerState())
+		_, err = limiter.Get(id)
+		assert.Equal("connection refused", err.Error())
+		assert.Equal(BreakerOpen, limiter.BreakerState())
+		_, err = limiter.Get(id)
+		assert.Equal(ErrCircuitOpen, err)
+		assert.Equal(5, client.evalSha)
+
+		// a successful test request closes the breaker
+		time.Sleep(60 * time.Millisecond)
+		client.fail(nil)
+		res, err = limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(9, res.Remaining)
+		assert.Equal(BreakerClosed, limiter.BreakerState())
+	})
+
+	t.Run("limiter with circuit breaker window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &mockRedisClient{}
+		limiter := New(Options{
+			Client:           client,
+			BreakerThreshold: 2,
+			BreakerWindow:    20 * time.Millisecond,
+		})
+		id := genID()
+
+		client.fail(errors.New("timeout"))
+		limiter.Get(id)
+		time.Sleep(30 * time.Millisecond)
+		limiter.Get(id)
+		assert.Equal(BreakerClosed, limiter.BreakerState())
+		limiter.Get(id)
+		assert.Equal(BreakerOpen, limiter.BreakerState())
+	})
+
+	t.Run("limiter with BreakerFailOpen should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &mockRedisClient{}
+		limiter := New(Options{
+			Client:           client,
+			Max:              5,
+			BreakerThreshold: 1,
+			BreakerFailOpen:  true,
+		})
+		id := genID()
+
+		client.fail(errors.New("timeout"))
+		_, err := limiter.Get(id)
+		assert.Equal("timeout", err.Error())
+		assert.Equal(BreakerOpen, limiter.BreakerState())
+
+		res, err := limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(5, res.Total)
+		assert.Equal(4, res.Remaining)
+		assert.Equal(time.Minute, res.Duration)
+
+		res, err = limiter.Get(id, 3, 1000, 1, 2000)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(2, res.Remaining)
+		assert.Equal(time.Second, res.Duration)
+		assert.Equal(1, client.evalSha)
+	})
+
+	t.Run("limiter without circuit breaker should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(BreakerClosed, New(Options{}).BreakerState())
+		assert.Equal("half-open", BreakerHalfOpen.String())
+	})
+}
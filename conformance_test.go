@@ -0,0 +1,355 @@
+package ratelimiter
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedisClient is an in-process redis that runs the limit script and the remove script,
+// the limit script is ported from ratelimiter.lua command by command.
+type fakeRedisClient struct {
+	lock sync.Mutex
+	data map[string]*fakeRedisEntry
+}
+
+type fakeRedisEntry struct {
+	str    string
+	hash   map[string]string
+	expire time.Time // zero if the key never expires
+}
+
+func newFakeRedisClient() *fakeRedisClient {
+	return &fakeRedisClient{data: make(map[string]*fakeRedisEntry)}
+}
+
+func (c *fakeRedisClient) RateDel(key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.del(key)
+	return nil
+}
+
+func (c *fakeRedisClient) RateEvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	argv := make([]string, len(args))
+	for i, arg := range args {
+		argv[i] = arg.(string)
+	}
+	switch sha1 {
+	case scriptSha1(lua):
+		return c.limit(keys, argv), nil
+	case scriptSha1(removeLua):
+		count := int64(0)
+		for _, key := range keys {
+			if c.entry(key) != nil {
+				c.del(key)
+				count++
+			}
+		}
+		return count, nil
+	}
+	return nil, errors.New("ERR fake redis runs only the limit script and the remove script")
+}
+
+func (c *fakeRedisClient) RateScriptLoad(script string) (string, error) {
+	return scriptSha1(script), nil
+}
+
+// limit is ratelimiter.lua.
+func (c *fakeRedisClient) limit(keys, argv []string) []interface{} {
+	n := len(argv)
+	now := fakeInt(argv[0])
+	policy := argv[1 : n-4]
+	if argv[n-1] == "1" {
+		if mx, ok := c.hget(keys[5], "mx"); ok {
+			dn, _ := c.hget(keys[5], "dn")
+			policy = []string{mx, dn}
+		}
+	}
+	policyCount := int64(len(policy) / 2)
+	blockCount := fakeInt(argv[n-4])
+	cooldown := fakeInt(argv[n-2])
+	blocked := false
+
+	var ct, lt, dn, rt, fw, ov int64
+	if count, ok := c.hget(keys[0], "ct"); ok {
+		ct = fakeInt(count) - 1
+		lt = c.hgetInt(keys[0], "lt")
+		dn = fakeInt(policy[1])
+		if d, ok := c.hget(keys[0], "dn"); ok {
+			dn = fakeInt(d)
+		}
+		rt = c.hgetInt(keys[0], "rt")
+		fw = c.hgetInt(keys[0], "fw")
+
+		if policyCount > 1 && ct == -1 {
+			top := c.getInt(keys[1], 1) >= policyCount
+			if cooldown == 0 || c.set(keys[6], "1", cooldown, true) {
+				if c.incr(keys[1]) == 1 {
+					c.incr(keys[1])
+				}
+			}
+			c.pexpire(keys[1], dn*2)
+
+			if blockCount > 0 {
+				hits := int64(0)
+				if top {
+					hits = c.incr(keys[4])
+				}
+				c.pexpire(keys[4], dn*2)
+				if hits >= blockCount {
+					c.del(keys[4])
+					blocked = true
+				}
+			}
+		}
+
+		if ct >= -1 {
+			c.hincrby(keys[0], "ct", -1)
+		} else {
+			ct = -1
+		}
+		if ct >= 0 {
+			c.hincrby(keys[0], "al", 1)
+		}
+		if ct == -1 {
+			ov = c.hincrby(keys[0], "ov", 1)
+		}
+
+		if blocked {
+			penalty := fakeInt(argv[n-3])
+			dn = penalty
+			rt = now + penalty
+			fw = 0
+			ov = 1
+			c.hset(keys[0], "ct", "-1", "dn", fakeStr(dn), "rt", fakeStr(rt), "fw", "0", "ov", "1")
+			c.pexpire(keys[0], penalty)
+			if c.pttl(keys[3]) < penalty*2 {
+				c.set(keys[3], "1", penalty*2, false)
+			}
+		}
+	} else {
+		index := int64(1)
+		if policyCount > 1 {
+			index = c.getInt(keys[1], 1)
+			if index > policyCount {
+				index = policyCount
+			}
+		}
+
+		lt = fakeInt(policy[index*2-2])
+		ct = lt - 1
+		dn = fakeInt(policy[index*2-1])
+		rt = now + dn
+		fw = 1
+		if c.entry(keys[3]) != nil {
+			fw = 0
+		}
+
+		c.hset(keys[0], "ct", fakeStr(ct), "lt", fakeStr(lt), "dn", fakeStr(dn), "rt", fakeStr(rt), "fw", fakeStr(fw), "al", "1")
+		c.set(keys[3], "1", dn*2, false)
+		c.pexpire(keys[0], dn)
+		if c.entry(keys[2]) != nil {
+			c.pexpire(keys[2], dn*2)
+		}
+	}
+
+	c.hset(keys[0], "la", argv[0])
+	var meta interface{}
+	if e := c.entry(keys[2]); e != nil {
+		meta = e.str
+	}
+	return []interface{}{ct, lt, dn, rt, meta, fw, int64(0), ov, c.hgetInt(keys[0], "al")}
+}
+
+// entry returns the live entry of key, it deletes an expired one.
+func (c *fakeRedisClient) entry(key string) *fakeRedisEntry {
+	e, ok := c.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expire.IsZero() && !time.Now().Before(e.expire) {
+		delete(c.data, key)
+		return nil
+	}
+	return e
+}
+
+func (c *fakeRedisClient) del(key string) {
+	delete(c.data, key)
+}
+
+func (c *fakeRedisClient) set(key, val string, px int64, nx bool) bool {
+	if nx && c.entry(key) != nil {
+		return false
+	}
+	c.data[key] = &fakeRedisEntry{str: val, expire: time.Now().Add(time.Duration(px) * time.Millisecond)}
+	return true
+}
+
+func (c *fakeRedisClient) getInt(key string, missing int64) int64 {
+	if e := c.entry(key); e != nil {
+		return fakeInt(e.str)
+	}
+	return missing
+}
+
+func (c *fakeRedisClient) incr(key string) int64 {
+	e := c.entry(key)
+	if e == nil {
+		e = &fakeRedisEntry{str: "0"}
+		c.data[key] = e
+	}
+	val := fakeInt(e.str) + 1
+	e.str = fakeStr(val)
+	return val
+}
+
+func (c *fakeRedisClient) pexpire(key string, ms int64) {
+	if e := c.entry(key); e != nil {
+		e.expire = time.Now().Add(time.Duration(ms) * time.Millisecond)
+	}
+}
+
+// pttl returns -2 if key doesn't exist and -1 if it never expires, as redis does.
+func (c *fakeRedisClient) pttl(key string) int64 {
+	e := c.entry(key)
+	if e == nil {
+		return -2
+	}
+	if e.expire.IsZero() {
+		return -1
+	}
+	return int64(time.Until(e.expire) / time.Millisecond)
+}
+
+func (c *fakeRedisClient) hget(key, field string) (string, bool) {
+	if e := c.entry(key); e != nil {
+		val, ok := e.hash[field]
+		return val, ok
+	}
+	return "", false
+}
+
+func (c *fakeRedisClient) hgetInt(key, field string) int64 {
+	val, _ := c.hget(key, field)
+	return fakeInt(val)
+}
+
+func (c *fakeRedisClient) hset(key string, pairs ...string) {
+	e := c.entry(key)
+	if e == nil {
+		e = &fakeRedisEntry{}
+		c.data[key] = e
+	}
+	if e.hash == nil {
+		e.hash = make(map[string]string)
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		e.hash[pairs[i]] = pairs[i+1]
+	}
+}
+
+func (c *fakeRedisClient) hincrby(key, field string, by int64) int64 {
+	val := c.hgetInt(key, field) + by
+	c.hset(key, field, fakeStr(val))
+	return val
+}
+
+// fakeInt is tonumber of the script, 0 if s is no number.
+func fakeInt(s string) int64 {
+	val, _ := strconv.ParseInt(s, 10, 64)
+	return val
+}
+
+func fakeStr(val int64) string {
+	return strconv.FormatInt(val, 10)
+}
+
+type conformanceStep struct {
+	sleep  time.Duration // sleep before the step
+	gets   int           // the count of Get calls
+	remove bool          // call Remove before the Get calls
+}
+
+// The same scenarios run against the memory limiter and the redis limiter on fakeRedisClient.
+var conformanceScenarios = []struct {
+	name   string
+	policy []int
+	steps  []conformanceStep
+}{
+	{"single policy", []int{3, 100}, []conformanceStep{
+		{gets: 5}, {sleep: 110 * time.Millisecond, gets: 2}, {remove: true, gets: 4},
+	}},
+	{"escalation and decay", []int{2, 100, 2, 200, 3, 300}, []conformanceStep{
+		{gets: 3}, {sleep: 110 * time.Millisecond, gets: 3}, {sleep: 210 * time.Millisecond, gets: 4},
+		{sleep: 610 * time.Millisecond, gets: 2},
+	}},
+	{"escalation with expired status", []int{1, 100, 1, 300, 1, 100}, []conformanceStep{
+		{gets: 2}, {sleep: 110 * time.Millisecond, gets: 1}, {sleep: 240 * time.Millisecond, gets: 2},
+		{sleep: 60 * time.Millisecond, gets: 2},
+	}},
+	{"remove while escalated", []int{1, 100, 2, 100}, []conformanceStep{
+		{gets: 2}, {sleep: 110 * time.Millisecond, gets: 1}, {remove: true, gets: 2},
+	}},
+}
+
+func TestBackendConformance(t *testing.T) {
+	for _, scenario := range conformanceScenarios {
+		scenario := scenario
+		t.Run(scenario.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			id := genID()
+			memory := New(Options{})
+			redis := New(Options{Client: newFakeRedisClient()})
+			for i, step := range scenario.steps {
+				time.Sleep(step.sleep)
+				if step.remove {
+					assert.Nil(memory.Remove(id))
+					assert.Nil(redis.Remove(id))
+				}
+				for j := 0; j < step.gets; j++ {
+					want, err := memory.Get(id, scenario.policy...)
+					assert.Nil(err)
+					got, err := redis.Get(id, scenario.policy...)
+					assert.Nil(err)
+					// Reset is a timestamp, it is compared within the clock difference.
+					assert.WithinDuration(want.Reset, got.Reset, 20*time.Millisecond)
+					want.Reset, got.Reset = time.Time{}, time.Time{}
+					assert.Equal(want, got, "step %d, get %d", i, j)
+				}
+			}
+		})
+	}
+}
+
+func TestFakeRedisRemove(t *testing.T) {
+	t.Run("limiter.Remove should delete the keys of the record in one script", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := newFakeRedisClient()
+		limiter := New(Options{Client: client})
+		id := genID()
+		limiter.Get(id, 1, 1000, 1, 2000)
+		limiter.Get(id, 1, 1000, 1, 2000)
+		key := "LIMIT:" + id
+		client.set("{"+key+"}:M", "meta", 1000, false)
+		client.set("{"+key+"}:P", "policy", 1000, false)
+		assert.NotNil(client.entry(key))
+		assert.NotNil(client.entry("{" + key + "}:S"))
+
+		assert.Nil(limiter.Remove(id))
+		for _, suffix := range []string{"S", "M", "F", "T", "E"} {
+			assert.Nil(client.entry("{" + key + "}:" + suffix))
+		}
+		assert.Nil(client.entry(key))
+		assert.NotNil(client.entry("{" + key + "}:P"))
+	})
+}
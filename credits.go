@@ -0,0 +1,236 @@
+package ratelimiter
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// credits of one key
+type creditsCacheItem struct {
+	total    int
+	credits  int
+	interval time.Duration
+	last     time.Time
+}
+
+// full returns the time all credits are earned back.
+func (c *creditsCacheItem) full() time.Time {
+	return c.last.Add(time.Duration(c.total-c.credits) * c.interval)
+}
+
+type creditsMemoryLimiter struct {
+	max      int
+	duration time.Duration
+	interval time.Duration
+	store    map[string]*creditsCacheItem
+	ticker   *time.Ticker
+	lock     sync.Mutex
+	onSweep  func(stats SweepStats)
+	closed   bool
+	done     chan struct{}
+}
+
+func newCreditsMemoryLimiter(opts *Options) *creditsMemoryLimiter {
+	m := &creditsMemoryLimiter{
+		max:      opts.Max,
+		duration: opts.Duration,
+		interval: opts.EarnBackInterval,
+		store:    make(map[string]*creditsCacheItem),
+		onSweep:  opts.OnSweep,
+	}
+	if !opts.DisableBackgroundCleanup {
+		m.ticker = time.NewTicker(time.Second)
+		m.done = make(chan struct{})
+		go m.cleanCache()
+	}
+	return m
+}
+
+// abstractLimiter interface
+func (m *creditsMemoryLimiter) getLimit(key string, policy ...int) ([]interface{}, error) {
+	total, duration, err := creditsPolicy(m.max, m.duration, policy...)
+	if err != nil {
+		return nil, err
+	}
+	interval := earnBackInterval(m.interval, total, duration)
+	now := time.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return nil, ErrDrained
+	}
+	item, ok := m.store[key]
+	if !ok {
+		item = &creditsCacheItem{credits: total, last: now}
+		m.store[key] = item
+	} else {
+		// earn back the credits lazily, the same as credits.lua.
+		if earned := int(now.Sub(item.last) / interval); earned > 0 {
+			item.credits += earned
+			item.last = item.last.Add(time.Duration(earned) * interval)
+		}
+		if item.credits >= total {
+			item.credits = total
+			item.last = now
+		}
+	}
+	item.total = total
+	item.interval = interval
+
+	remaining := -1
+	if item.credits > 0 {
+		item.credits--
+		remaining = item.credits
+	}
+	return []interface{}{remaining, total, duration, item.last.Add(interval)}, nil
+}
+
+// abstractLimiter interface
+func (m *creditsMemoryLimiter) removeLimit(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.store, key)
+	return nil
+}
+
+func (m *creditsMemoryLimiter) clean() {
+	var stats SweepStats
+	if m.onSweep != nil {
+		begin := time.Now()
+		defer func() {
+			stats.Duration = time.Since(begin)
+			m.onSweep(stats)
+		}()
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	stats.Examined = len(m.store)
+	for key, item := range m.store {
+		// a full record is the same as no record.
+		if !item.full().After(now) {
+			delete(m.store, key)
+			stats.Evicted++
+		}
+	}
+}
+
+func (m *creditsMemoryLimiter) cleanCache() {
+	for {
+		select {
+		case <-m.ticker.C:
+			m.clean()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+type creditsRedisLimiter struct {
+	sha1, max, duration string
+	maxCount            int
+	window, interval    time.Duration
+	rc                  RedisClient
+}
+
+func newCreditsRedisLimiter(opts *Options) *creditsRedisLimiter {
+	r := &creditsRedisLimiter{
+		rc:       opts.Client,
+		sha1:     loadScript(opts, creditsLua),
+		max:      strconv.FormatInt(int64(opts.Max), 10),
+		duration: strconv.FormatInt(int64(opts.Duration/time.Millisecond), 10),
+		maxCount: opts.Max,
+		window:   opts.Duration,
+		interval: opts.EarnBackInterval,
+	}
+	return r
+}
+
+// abstractLimiter interface
+func (r *creditsRedisLimiter) getLimit(key string, policy ...int) ([]interface{}, error) {
+	total, duration, err := creditsPolicy(r.maxCount, r.window, policy...)
+	if err != nil {
+		return nil, err
+	}
+	interval := earnBackInterval(r.interval, total, duration) / time.Millisecond
+	if interval <= 0 {
+		interval = 1
+	}
+	args := []interface{}{genTimestamp(), r.max, r.duration, strconv.FormatInt(int64(interval), 10)}
+	if len(policy) > 0 {
+		args[1] = strconv.FormatInt(int64(total), 10)
+		args[2] = strconv.FormatInt(int64(duration/time.Millisecond), 10)
+	}
+	return evalLimit(r.rc, r.sha1, creditsLua, []string{key}, args...)
+}
+
+// abstractLimiter interface
+func (r *creditsRedisLimiter) removeLimit(key string) error {
+	return r.rc.RateDel(key)
+}
+
+// creditsPolicy returns the max count and duration for credits.
+func creditsPolicy(max int, duration time.Duration, policy ...int) (int, time.Duration, error) {
+	if len(policy) > 2 {
+		return 0, 0, errors.New("ratelimiter: credits supports one policy only")
+	}
+	return slidingPolicy(max, duration, policy...)
+}
+
+// earnBackInterval returns the time to earn back one credit,
+// by default all credits are earned back in one duration.
+func earnBackInterval(interval time.Duration, total int, duration time.Duration) time.Duration {
+	if interval > 0 {
+		return interval
+	}
+	if interval = duration / time.Duration(total); interval > 0 {
+		return interval
+	}
+	return time.Nanosecond
+}
+
+// copy from ./credits.lua
+const creditsLua string = `
+-- KEYS[1] target hash key
+-- ARGV[1] current timestamp, ARGV[2] max count, ARGV[3] duration, ARGV[4] earn-back interval
+
+-- HASH: KEYS[1]
+--   field:ct(credits), value: the credits left
+--   field:lt(last), value: the timestamp the credits were last earned back
+
+local now = tonumber(ARGV[1])
+local total = tonumber(ARGV[2])
+local duration = tonumber(ARGV[3])
+local interval = tonumber(ARGV[4])
+
+local credits = total
+local last = now
+local item = redis.call('hmget', KEYS[1], 'ct', 'lt')
+if item[1] then
+  credits = tonumber(item[1])
+  last = tonumber(item[2])
+  local earned = math.floor((now - last) / interval)
+  if earned > 0 then
+    credits = credits + earned
+    last = last + earned * interval
+  end
+  if credits >= total then
+    credits = total
+    last = now
+  end
+end
+
+local res = {-1, total, duration, last + interval}
+if credits > 0 then
+  credits = credits - 1
+  res[1] = credits
+end
+
+redis.call('hmset', KEYS[1], 'ct', credits, 'lt', last)
+-- the record is full again after all credits are earned back, the same as no record.
+redis.call('pexpire', KEYS[1], last + (total - credits) * interval - now)
+return res
+`
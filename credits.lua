@@ -0,0 +1,39 @@
+-- KEYS[1] target hash key
+-- ARGV[1] current timestamp, ARGV[2] max count, ARGV[3] duration, ARGV[4] earn-back interval
+
+-- HASH: KEYS[1]
+--   field:ct(credits), value: the credits left
+--   field:lt(last), value: the timestamp the credits were last earned back
+
+local now = tonumber(ARGV[1])
+local total = tonumber(ARGV[2])
+local duration = tonumber(ARGV[3])
+local interval = tonumber(ARGV[4])
+
+local credits = total
+local last = now
+local item = redis.call('hmget', KEYS[1], 'ct', 'lt')
+if item[1] then
+  credits = tonumber(item[1])
+  last = tonumber(item[2])
+  local earned = math.floor((now - last) / interval)
+  if earned > 0 then
+    credits = credits + earned
+    last = last + earned * interval
+  end
+  if credits >= total then
+    credits = total
+    last = now
+  end
+end
+
+local res = {-1, total, duration, last + interval}
+if credits > 0 then
+  credits = credits - 1
+  res[1] = credits
+end
+
+redis.call('hmset', KEYS[1], 'ct', credits, 'lt', last)
+-- the record is full again after all credits are earned back, the same as no record.
+redis.call('pexpire', KEYS[1], last + (total - credits) * interval - now)
+return res
@@ -0,0 +1,92 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreditsMemoryRateLimiter(t *testing.T) {
+	t.Run("ratelimiter with credits should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: Credits})
+		id := genID()
+		policy := []int{10, 1000}
+
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(10, res.Total)
+		assert.Equal(9, res.Remaining)
+		assert.Equal(time.Second, res.Duration)
+		assert.True(res.Reset.After(time.Now()))
+		for i := 8; i >= 5; i-- {
+			res, _ = limiter.Get(id, policy...)
+			assert.Equal(i, res.Remaining)
+		}
+
+		// one credit is earned back every 100ms
+		time.Sleep(250 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(6, res.Remaining)
+
+		// credits are capped at total, there is no double burst
+		time.Sleep(1100 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(9, res.Remaining)
+	})
+
+	t.Run("ratelimiter with credits and EarnBackInterval should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: Credits, Max: 3, EarnBackInterval: 100 * time.Millisecond})
+		id := genID()
+
+		res, _ := limiter.Get(id)
+		assert.Equal(2, res.Remaining)
+		limiter.Get(id)
+		limiter.Get(id)
+		res, _ = limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+		assert.True(res.Reset.After(time.Now()))
+		assert.True(res.Reset.Before(time.Now().Add(100 * time.Millisecond)))
+
+		time.Sleep(110 * time.Millisecond)
+		res, _ = limiter.Get(id)
+		assert.Equal(0, res.Remaining)
+		res, _ = limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+
+		assert.Nil(limiter.Remove(id))
+		res, _ = limiter.Get(id)
+		assert.Equal(2, res.Remaining)
+	})
+
+	t.Run("ratelimiter with credits and multi-policy should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: Credits})
+		_, err := limiter.Get(genID(), 5, 200, 3, 400)
+		assert.Equal("ratelimiter: credits supports one policy only", err.Error())
+		_, err = limiter.Get(genID(), 5, 0)
+		assert.Equal("ratelimiter: must be positive integer", err.Error())
+	})
+
+	t.Run("ratelimiter with credits clean should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: Credits, Max: 2, EarnBackInterval: 20 * time.Millisecond})
+		backend := limiter.abstractLimiter.(*creditsMemoryLimiter)
+		id := genID()
+		limiter.Get(id)
+		backend.clean()
+		assert.Equal(1, len(backend.store))
+
+		time.Sleep(30 * time.Millisecond)
+		backend.clean()
+		assert.Equal(0, len(backend.store))
+	})
+}
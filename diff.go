@@ -0,0 +1,71 @@
+package ratelimiter
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// KeyState is the state of the live window of an id, see StateDiff.
+type KeyState struct {
+	Total     int
+	Remaining int
+	Tier      int // The multi-policy tier of the next window, 1 if not escalated.
+}
+
+// KeyDiff is a difference of an id between two limiters, a nil state means no live window.
+type KeyDiff struct {
+	ID    string
+	This  *KeyState
+	Other *KeyState
+}
+
+// StateDiff is a testing helper, it compares the snapshots of two memory limiters and returns
+// the ids with different live windows (the total, remaining or tier), sorted by id.
+// The ids are compared without the prefixes of the limiters. An empty diff means a Get
+// on either limiter would return the same Remaining and Total for every id.
+func (l *Limiter) StateDiff(other *Limiter) ([]KeyDiff, error) {
+	this, ok := l.abstractLimiter.(snapshotter)
+	if !ok {
+		return nil, errors.New("ratelimiter: snapshot is only supported by memory limiter")
+	}
+	that, ok := other.abstractLimiter.(snapshotter)
+	if !ok {
+		return nil, errors.New("ratelimiter: snapshot is only supported by memory limiter")
+	}
+	states := stateOf(this.snapshot(), l.prefix)
+	others := stateOf(that.snapshot(), other.prefix)
+
+	var diffs []KeyDiff
+	for id, state := range states {
+		if o, ok := others[id]; !ok || *o != *state {
+			diffs = append(diffs, KeyDiff{ID: id, This: state, Other: o})
+		}
+	}
+	for id, o := range others {
+		if _, ok := states[id]; !ok {
+			diffs = append(diffs, KeyDiff{ID: id, Other: o})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].ID < diffs[j].ID })
+	return diffs, nil
+}
+
+// stateOf returns the states of the live windows in a snapshot by id.
+func stateOf(s *memorySnapshot, prefix string) map[string]*KeyState {
+	states := make(map[string]*KeyState, len(s.Store))
+	for key, item := range s.Store {
+		if !item.Expire.After(s.Time) {
+			continue
+		}
+		state := &KeyState{Total: item.Total, Remaining: item.Remaining, Tier: 1}
+		if item.Remaining < 0 {
+			state.Remaining = -1
+		}
+		if status, ok := s.Status["{"+key+"}:S"]; ok && status.Expire.After(s.Time) {
+			state.Tier = status.Index
+		}
+		states[strings.TrimPrefix(key, prefix)] = state
+	}
+	return states
+}
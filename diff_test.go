@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStateDiff(t *testing.T) {
+	t.Run("limiter.StateDiff should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		a := New(Options{})
+		b := New(Options{Prefix: "OTHER:"})
+		id1, id2, id3 := genID(), genID(), genID()
+		policy := []int{1, 1000, 5, 1000}
+
+		for _, l := range []*Limiter{a, b} {
+			l.Get(id1)
+			l.Get(id1)
+			l.Get(id2, policy...)
+			l.Get(id2, policy...)
+		}
+		diffs, err := a.StateDiff(b)
+		assert.Nil(err)
+		assert.Equal(0, len(diffs))
+
+		// a denied request after the escalation doesn't change the state
+		a.Get(id2, policy...)
+		diffs, err = a.StateDiff(b)
+		assert.Nil(err)
+		assert.Equal(0, len(diffs))
+
+		a.Get(id1)
+		b.Get(id3)
+		diffs, err = a.StateDiff(b)
+		assert.Nil(err)
+		expected := []KeyDiff{
+			{ID: id1, This: &KeyState{100, 97, 1}, Other: &KeyState{100, 98, 1}},
+			{ID: id3, Other: &KeyState{100, 99, 1}},
+		}
+		if id3 < id1 {
+			expected[0], expected[1] = expected[1], expected[0]
+		}
+		assert.Equal(expected, diffs)
+	})
+
+	t.Run("limiter.StateDiff with tier should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		a := New(Options{})
+		b := New(Options{})
+		id := genID()
+		policy := []int{1, 30, 1, 30}
+		a.Get(id, policy...)
+		b.Get(id, policy...)
+		a.Get(id, policy...)
+		time.Sleep(40 * time.Millisecond)
+		a.Get(id, policy...)
+		b.Get(id, policy...)
+
+		diffs, err := a.StateDiff(b)
+		assert.Nil(err)
+		assert.Equal([]KeyDiff{{ID: id, This: &KeyState{1, 0, 2}, Other: &KeyState{1, 0, 1}}}, diffs)
+	})
+
+	t.Run("limiter.StateDiff with redis should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := New(Options{}).StateDiff(New(Options{Client: &mockRedisClient{}}))
+		assert.Equal("ratelimiter: snapshot is only supported by memory limiter", err.Error())
+	})
+}
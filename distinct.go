@@ -0,0 +1,118 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// distinctCap is the most sub-ids a memory limiter keeps per source.
+const distinctCap = 4096
+
+// distinct sub-ids of a source
+type distinctItem struct {
+	subs   map[string]struct{}
+	expire time.Time
+}
+
+type distinctEstimator interface {
+	// addDistinct adds sub to the set of key and returns the approximate count of the set.
+	addDistinct(key, sub string) (int, error)
+	distinctCount(key string) (int, error)
+}
+
+// AddDistinct records that sourceID tried subID, for example an IP trying a username,
+// and returns the approximate count of distinct sub-ids sourceID tried in its window.
+// The window of a source starts with its first sub-id and lasts Options.Duration.
+// If the count exceeds Options.DistinctThreshold, sourceID is blocked for Options.Duration
+// as by Block, so Get(sourceID) denies it, and every further sub-id extends the block.
+//
+// The count is approximate: a redis limiter counts with HyperLogLog, whose standard error
+// is 0.81%, and a memory limiter counts exactly, but it stops at 4096 sub-ids per source.
+// It is supported by fixed window limiters only.
+func (l *Limiter) AddDistinct(sourceID, subID string) (int, error) {
+	d, ok := l.abstractLimiter.(distinctEstimator)
+	if !ok {
+		return 0, errors.New("ratelimiter: distinct count is only supported by fixed window limiter")
+	}
+	count, err := d.addDistinct(l.prefix+sourceID, subID)
+	if err != nil {
+		return 0, err
+	}
+	if l.distinctThreshold > 0 && count > l.distinctThreshold {
+		if err = l.Block(sourceID, l.duration); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// DistinctCount returns the approximate count of distinct sub-ids sourceID tried in its window,
+// see AddDistinct. It is 0 if sourceID has no window.
+func (l *Limiter) DistinctCount(sourceID string) (int, error) {
+	d, ok := l.abstractLimiter.(distinctEstimator)
+	if !ok {
+		return 0, errors.New("ratelimiter: distinct count is only supported by fixed window limiter")
+	}
+	return d.distinctCount(l.prefix + sourceID)
+}
+
+// distinctEstimator interface
+func (m *memoryLimiter) addDistinct(key, sub string) (int, error) {
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.distinct[key]
+	if !ok || !item.expire.After(now) {
+		item = &distinctItem{subs: make(map[string]struct{}), expire: now.Add(m.duration)}
+		m.distinct[key] = item
+	}
+	if len(item.subs) < distinctCap {
+		item.subs[sub] = struct{}{}
+	}
+	return len(item.subs), nil
+}
+
+// distinctEstimator interface
+func (m *memoryLimiter) distinctCount(key string) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.distinct[key]
+	if !ok || !item.expire.After(time.Now()) {
+		return 0, nil
+	}
+	return len(item.subs), nil
+}
+
+// distinctEstimator interface
+func (r *redisLimiter) addDistinct(key, sub string) (int, error) {
+	res, err := evalScript(r.rc, r.distinctSha1, distinctLua, []string{fmt.Sprintf("{%s}:D", key)}, sub, r.duration)
+	if err != nil {
+		return 0, err
+	}
+	count, _ := res.(int64)
+	return int(count), nil
+}
+
+// distinctEstimator interface
+func (r *redisLimiter) distinctCount(key string) (int, error) {
+	res, err := evalScript(r.rc, r.distinctSha1, distinctLua, []string{fmt.Sprintf("{%s}:D", key)})
+	if err != nil {
+		return 0, err
+	}
+	count, _ := res.(int64)
+	return int(count), nil
+}
+
+const distinctLua string = `
+-- KEYS[1] target distinct HyperLogLog key
+-- ARGV[1] sub-id to add and ARGV[2] duration, or none to count only
+
+if #ARGV > 0 then
+  redis.call('pfadd', KEYS[1], ARGV[1])
+  if redis.call('pttl', KEYS[1]) < 0 then
+    redis.call('pexpire', KEYS[1], ARGV[2])
+  end
+end
+return redis.call('pfcount', KEYS[1])
+`
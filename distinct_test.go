@@ -0,0 +1,70 @@
+package ratelimiter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryDistinct(t *testing.T) {
+	t.Run("limiter.AddDistinct should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Duration: 100 * time.Millisecond})
+		source := genID()
+		count, err := limiter.DistinctCount(source)
+		assert.Nil(err)
+		assert.Equal(0, count)
+
+		for i := 0; i < 10; i++ {
+			count, err = limiter.AddDistinct(source, "user-"+strconv.Itoa(i%5))
+			assert.Nil(err)
+		}
+		assert.Equal(5, count)
+		count, _ = limiter.DistinctCount(source)
+		assert.Equal(5, count)
+		count, _ = limiter.DistinctCount(genID())
+		assert.Equal(0, count)
+
+		// the window of the source expires
+		time.Sleep(110 * time.Millisecond)
+		count, _ = limiter.DistinctCount(source)
+		assert.Equal(0, count)
+		count, _ = limiter.AddDistinct(source, "user-0")
+		assert.Equal(1, count)
+
+		for i := 0; i < distinctCap+10; i++ {
+			count, _ = limiter.AddDistinct(source, strconv.Itoa(i))
+		}
+		assert.Equal(distinctCap, count)
+	})
+
+	t.Run("limiter.AddDistinct should block the source over DistinctThreshold", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{DistinctThreshold: 3})
+		source := genID()
+		for i := 0; i < 3; i++ {
+			limiter.AddDistinct(source, strconv.Itoa(i))
+		}
+		res, _ := limiter.Get(source)
+		assert.True(res.Allowed())
+
+		count, err := limiter.AddDistinct(source, "3")
+		assert.Nil(err)
+		assert.Equal(4, count)
+		res, _ = limiter.Get(source)
+		assert.False(res.Allowed())
+		assert.Equal(time.Minute, res.Duration)
+	})
+
+	t.Run("sliding window limiter should not be supported", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow})
+		_, err := limiter.AddDistinct(genID(), "user")
+		assert.Equal("ratelimiter: distinct count is only supported by fixed window limiter", err.Error())
+	})
+}
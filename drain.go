@@ -0,0 +1,114 @@
+package ratelimiter
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDrained is returned by Get for an id without a live window when the limiter is drained.
+var ErrDrained = errors.New("ratelimiter: limiter is drained")
+
+type drainer interface {
+	drain()
+}
+
+type closer interface {
+	close()
+}
+
+// Drain stops the limiter from creating windows before shutdown: Get of an id without a live window
+// fails with ErrDrained, and the live windows are served as usual until they expire.
+// It can't be undone. In a rolling deploy, a node drains so its new traffic shifts away,
+// waits for the live windows (up to the longest duration of the policies), then calls Close:
+//
+//	limiter.Drain()
+//	time.Sleep(time.Minute)
+//	limiter.Close()
+//
+// It is supported by the memory fixed window limiter only.
+func (l *Limiter) Drain() error {
+	d, ok := l.abstractLimiter.(drainer)
+	if !ok {
+		return errors.New("ratelimiter: drain is only supported by memory limiter")
+	}
+	d.drain()
+	return nil
+}
+
+// Close stops the background goroutines of the limiter: the periodic snapshot of
+// Options.SnapshotInterval, and the cleanup of a memory limiter. With Options.SnapshotWriter,
+// it flushes a last snapshot first, then a memory limiter drops its records and its Get fails
+// with ErrDrained. It is safe to call more than once, only the first call flushes and returns
+// the error of the flush. A redis limiter keeps nothing, the redis client is closed by its owner.
+func (l *Limiter) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		if l.snapshotStopped != nil {
+			<-l.snapshotStopped
+		}
+		if _, ok := l.abstractLimiter.(snapshotter); ok && l.snapshotWriter != nil {
+			err = l.Flush()
+		}
+		if c, ok := l.abstractLimiter.(closer); ok {
+			c.close()
+		}
+	})
+	return err
+}
+
+// drainer interface
+func (m *memoryLimiter) drain() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.drained = true
+}
+
+// closer interface
+func (m *memoryLimiter) close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	m.drained = true
+	stopCleanup(m.ticker, m.done)
+	m.store = make(map[string]*limiterCacheItem)
+	m.status = make(map[string]*statusCacheItem)
+	m.distinct = make(map[string]*distinctItem)
+	m.cooldowns = make(map[string]time.Time)
+}
+
+// closer interface
+func (m *slidingMemoryLimiter) close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	stopCleanup(m.ticker, m.done)
+	m.store = make(map[string]*slidingCacheItem)
+}
+
+// closer interface
+func (m *creditsMemoryLimiter) close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	stopCleanup(m.ticker, m.done)
+	m.store = make(map[string]*creditsCacheItem)
+}
+
+// stopCleanup stops the cleanup goroutine of a memory limiter, ticker is nil
+// with Options.DisableBackgroundCleanup.
+func stopCleanup(ticker *time.Ticker, done chan struct{}) {
+	if ticker != nil {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryDrain(t *testing.T) {
+	t.Run("limiter.Drain should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 3, Duration: 100 * time.Millisecond})
+		id := genID()
+		res, err := limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(2, res.Remaining)
+
+		assert.Nil(limiter.Drain())
+		res, err = limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(1, res.Remaining)
+
+		res, err = limiter.Get(genID())
+		assert.Equal(ErrDrained, err)
+		assert.Equal(Result{}, res)
+		_, err = limiter.PeekOrCreate(genID())
+		assert.Equal(ErrDrained, err)
+
+		// an expired window is not served again
+		time.Sleep(110 * time.Millisecond)
+		_, err = limiter.Get(id)
+		assert.Equal(ErrDrained, err)
+	})
+
+	t.Run("limiter.Close should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		m := limiter.abstractLimiter.(*memoryLimiter)
+		id := genID()
+		limiter.Get(id)
+
+		assert.Nil(limiter.Close())
+		assert.Equal(0, len(m.store))
+		_, err := limiter.Get(id)
+		assert.Equal(ErrDrained, err)
+		select {
+		case <-m.done:
+		default:
+			t.Error("cleanup should be stopped")
+		}
+		assert.Nil(limiter.Close())
+
+		limiter = New(Options{DisableBackgroundCleanup: true})
+		assert.Nil(limiter.Close())
+		limiter = New(Options{Algorithm: SlidingWindow})
+		limiter.Get(id)
+		assert.Nil(limiter.Close())
+		assert.Equal(0, len(limiter.abstractLimiter.(*slidingMemoryLimiter).store))
+		_, err = limiter.Get(id)
+		assert.Equal(ErrDrained, err)
+		limiter = New(Options{Algorithm: Credits})
+		assert.Nil(limiter.Close())
+		_, err = limiter.Get(id)
+		assert.Equal(ErrDrained, err)
+	})
+
+	t.Run("limiter.Close should flush a last snapshot and stop the snapshot loop", func(t *testing.T) {
+		assert := assert.New(t)
+
+		buf := &bytes.Buffer{}
+		limiter := New(Options{SnapshotWriter: buf, SnapshotInterval: time.Millisecond})
+		id := genID()
+		limiter.Get(id)
+		limiter.Get(id)
+		assert.Nil(limiter.Drain())
+		assert.Nil(limiter.Close())
+		size := buf.Len()
+		time.Sleep(5 * time.Millisecond)
+		assert.Equal(size, buf.Len())
+
+		// the last snapshot has the records before Close
+		restored := New(Options{})
+		assert.Nil(restored.RestoreFrom(buf))
+		res, err := restored.Peek(id)
+		assert.Nil(err)
+		assert.Equal(98, res.Remaining)
+		assert.Nil(limiter.Close())
+	})
+
+	t.Run("HybridLimiter.Close should close both limiters", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewHybrid(HybridOptions{})
+		limiter.Get(genID())
+		assert.Nil(limiter.Close())
+		assert.True(limiter.short.abstractLimiter.(*slidingMemoryLimiter).closed)
+		assert.True(limiter.long.abstractLimiter.(*memoryLimiter).closed)
+		_, err := limiter.Get(genID())
+		assert.Equal(ErrDrained, err)
+	})
+
+	t.Run("redis limiter should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Client: &mockRedisClient{}})
+		assert.Equal("ratelimiter: drain is only supported by memory limiter", limiter.Drain().Error())
+		assert.Nil(limiter.Close())
+	})
+}
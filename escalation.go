@@ -0,0 +1,124 @@
+package ratelimiter
+
+import (
+	"errors"
+	"time"
+)
+
+type escalationGuard interface {
+	// getLimitIfNotEscalated is getLimit if the key is not escalated,
+	// or it returns the denied result without counting and false.
+	getLimitIfNotEscalated(key string, policy ...int) ([]interface{}, bool, error)
+}
+
+// GetIfNotEscalated get a limiter result for id only if id is not escalated, that is,
+// its multi-policy status is at the first tier. It returns true if the request is counted
+// as Get does. For an escalated id, it returns a denied Result (see Options.OverLimitRemaining) and false
+// without counting, the check and the count are atomic.
+// The denied Result has the total and reset of the live window, or of the escalated tier
+// if the window has ended. It is supported by fixed window limiters only.
+func (l *Limiter) GetIfNotEscalated(id string, policy ...int) (Result, bool, error) {
+	g, ok := l.abstractLimiter.(escalationGuard)
+	if !ok {
+		return Result{}, false, errors.New("ratelimiter: escalation check is only supported by fixed window limiter")
+	}
+	counted := true
+	result, err := l.get(id, func(key string, policy ...int) ([]interface{}, error) {
+		res, ok, err := g.getLimitIfNotEscalated(key, policy...)
+		counted = ok
+		return res, err
+	}, policy...)
+	return result, counted && err == nil, err
+}
+
+// escalationGuard interface
+func (m *memoryLimiter) getLimitIfNotEscalated(key string, policy ...int) ([]interface{}, bool, error) {
+	args, err := m.limitArgs(policy...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	statusKey := "{" + key + "}:S"
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	status, ok := m.status[statusKey]
+	// a status of a former multi-policy doesn't escalate a single policy.
+	if !ok || len(args) <= 2 || status.index < 2 || status.expire.Before(now) {
+		if err := m.admit(key); err != nil {
+			return nil, false, err
+		}
+		return m.getItem(key, args...).result(), true, nil
+	}
+
+	if item, ok := m.store[key]; ok && item.expire.After(now) {
+		return []interface{}{-1, item.total, item.duration, item.expire, append([]byte(nil), item.meta...), false, item.overflow, item.allowed}, false, nil
+	}
+	index := status.index
+	if policyCount := len(args) / 2; index > policyCount {
+		index = policyCount
+	}
+	duration := time.Duration(args[(index*2)-1]) * time.Millisecond
+	var meta []byte
+	if item, ok := m.store[key]; ok {
+		meta = append(meta, item.meta...)
+	}
+	return []interface{}{-1, args[(index*2)-2], duration, now.Add(duration), meta, false, 0, 0}, false, nil
+}
+
+// escalationGuard interface
+func (r *redisLimiter) getLimitIfNotEscalated(key string, policy ...int) ([]interface{}, bool, error) {
+	keys, args, err := r.limitArgs(key, policy...)
+	if err != nil {
+		return nil, false, err
+	}
+	res, err := evalLimit(r.rc, r.notEscalatedSha1, notEscalatedLua, keys, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res) > 6 {
+		if escalated, _ := res[6].(int64); escalated == 1 {
+			return res, false, nil
+		}
+	}
+	return res, true, nil
+}
+
+// notEscalatedLua runs the limit script only if the status is at the first tier.
+const notEscalatedLua string = `
+-- KEYS and ARGV are the same as the limit script
+-- res[7] is 1 if the id is escalated and the request is not counted
+
+local status = tonumber(redis.call('get', KEYS[2])) or 1
+local policy = {}
+for i = 2, #ARGV - 4 do
+  policy[#policy + 1] = ARGV[i]
+end
+if ARGV[#ARGV] == '1' then
+  local stored = redis.call('hmget', KEYS[6], 'mx', 'dn')
+  if stored[1] then
+    policy = {stored[1], stored[2]}
+  end
+end
+local policyCount = #policy / 2
+-- a status of a former multi-policy doesn't escalate a single policy
+if status > 1 and policyCount > 1 then
+  local index = status
+  if index > policyCount then
+    index = policyCount
+  end
+
+  local res = {-1, tonumber(policy[index * 2 - 1]), tonumber(policy[index * 2]), 0, false, 0, 1, 0, 0}
+  res[4] = tonumber(ARGV[1]) + res[3]
+  local limit = redis.call('hmget', KEYS[1], 'lt', 'dn', 'rt', 'ov', 'al')
+  if limit[1] then
+    res[2] = tonumber(limit[1])
+    res[3] = tonumber(limit[2])
+    res[4] = tonumber(limit[3])
+    res[8] = tonumber(limit[4]) or 0
+    res[9] = tonumber(limit[5]) or 0
+  end
+  res[5] = redis.call('get', KEYS[3])
+  return res
+end
+` + lua
@@ -0,0 +1,111 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryGetIfNotEscalated(t *testing.T) {
+	t.Run("limiter.GetIfNotEscalated should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{2, 50, 5, 50}
+
+		// a tier-1 id is served normally
+		res, ok, err := limiter.GetIfNotEscalated(id, policy...)
+		assert.Nil(err)
+		assert.True(ok)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+		res, ok, _ = limiter.GetIfNotEscalated(id, policy...)
+		assert.True(ok)
+		assert.Equal(0, res.Remaining)
+
+		// escalated by the exhausting request
+		res, ok, _ = limiter.GetIfNotEscalated(id, policy...)
+		assert.True(ok)
+		assert.Equal(-1, res.Remaining)
+		res, ok, err = limiter.GetIfNotEscalated(id, policy...)
+		assert.Nil(err)
+		assert.False(ok)
+		assert.Equal(-1, res.Remaining)
+		assert.True(res.HardExceeded)
+		assert.Equal(2, res.Total)
+
+		// the escalated window is not consumed
+		time.Sleep(60 * time.Millisecond)
+		res, ok, _ = limiter.GetIfNotEscalated(id, policy...)
+		assert.False(ok)
+		assert.Equal(5, res.Total)
+		assert.Equal(-1, res.Remaining)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(5, res.Total)
+		assert.Equal(4, res.Remaining)
+		res, ok, _ = limiter.GetIfNotEscalated(id, policy...)
+		assert.False(ok)
+		assert.Equal(5, res.Total)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(3, res.Remaining)
+
+		// the status expires
+		time.Sleep(110 * time.Millisecond)
+		res, ok, _ = limiter.GetIfNotEscalated(id, policy...)
+		assert.True(ok)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+	})
+
+	t.Run("limiter.GetIfNotEscalated with a single policy should ignore the status", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		for i := 0; i < 3; i++ {
+			limiter.Get(id, 2, 50, 5, 50)
+		}
+		time.Sleep(60 * time.Millisecond)
+		res, ok, err := limiter.GetIfNotEscalated(id, 3, 50)
+		assert.Nil(err)
+		assert.True(ok)
+		assert.Equal(3, res.Total)
+		assert.Equal(2, res.Remaining)
+	})
+
+	t.Run("limiter.GetIfNotEscalated with OverLimitTrueOverflow should report the overflow", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{OverLimitRemaining: OverLimitTrueOverflow})
+		id := genID()
+		policy := []int{2, 50, 5, 50}
+		for i := 0; i < 4; i++ {
+			limiter.Get(id, policy...)
+		}
+		res, ok, err := limiter.GetIfNotEscalated(id, policy...)
+		assert.Nil(err)
+		assert.False(ok)
+		assert.Equal(-2, res.Remaining)
+
+		time.Sleep(60 * time.Millisecond)
+		res, ok, _ = limiter.GetIfNotEscalated(id, policy...)
+		assert.False(ok)
+		assert.Equal(-1, res.Remaining)
+	})
+
+	t.Run("limiter.GetIfNotEscalated with error should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		_, ok, err := limiter.GetIfNotEscalated(genID(), 1, 0)
+		assert.False(ok)
+		assert.Equal("ratelimiter: must be positive integer", err.Error())
+
+		limiter = New(Options{Algorithm: SlidingWindow})
+		_, ok, err = limiter.GetIfNotEscalated(genID())
+		assert.False(ok)
+		assert.Equal("ratelimiter: escalation check is only supported by fixed window limiter", err.Error())
+	})
+}
@@ -48,19 +48,34 @@ func main() {
 		Client:   &redisClient{client},
 	})
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/", handler(limiter))
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+
+// handler limits the requests by path. At the boundary of a window with Max 10:
+//
+//	10th request (the last allowed): 200, X-Ratelimit-Remaining: 0
+//	11th request (the first denied): 429, X-Ratelimit-Remaining: 0, Retry-After: seconds to Reset
+//
+// so only the status tells them apart, X-Ratelimit-Remaining is never negative.
+func handler(limiter *ratelimiter.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		res, err := limiter.Get(r.URL.Path)
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
 		}
 
+		remaining := res.Remaining
+		if !res.Allowed() {
+			remaining = 0
+		}
 		header := w.Header()
 		header.Set("X-Ratelimit-Limit", strconv.FormatInt(int64(res.Total), 10))
-		header.Set("X-Ratelimit-Remaining", strconv.FormatInt(int64(res.Remaining), 10))
+		header.Set("X-Ratelimit-Remaining", strconv.FormatInt(int64(remaining), 10))
 		header.Set("X-Ratelimit-Reset", strconv.FormatInt(res.Reset.Unix(), 10))
 
-		if res.Remaining >= 0 {
+		if res.Allowed() {
 			w.WriteHeader(200)
 			fmt.Fprintf(w, "Path: %q\n", html.EscapeString(r.URL.Path))
 			fmt.Fprintf(w, "Remaining: %d\n", res.Remaining)
@@ -68,11 +83,11 @@ func main() {
 			fmt.Fprintf(w, "Duration: %v\n", res.Duration)
 			fmt.Fprintf(w, "Reset: %v\n", res.Reset)
 		} else {
-			after := int64(res.Reset.Sub(time.Now())) / 1e9
+			// round up, so a client never retries before Reset
+			after := (int64(res.Reset.Sub(time.Now())) + 1e9 - 1) / 1e9
 			header.Set("Retry-After", strconv.FormatInt(after, 10))
 			w.WriteHeader(429)
 			fmt.Fprintf(w, "Rate limit exceeded, retry in %d seconds.\n", after)
 		}
-	})
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	}
 }
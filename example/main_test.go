@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	ratelimiter "github.com/teambition/ratelimiter-go"
+)
+
+func TestHandler(t *testing.T) {
+	t.Run("handler should tell the last allowed request from the first denied one", func(t *testing.T) {
+		assert := assert.New(t)
+
+		h := handler(ratelimiter.New(ratelimiter.Options{Max: 2, Duration: time.Minute}))
+		get := func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest("GET", "/boundary", nil))
+			return w
+		}
+
+		w := get()
+		assert.Equal(200, w.Code)
+		assert.Equal("1", w.Header().Get("X-Ratelimit-Remaining"))
+
+		w = get()
+		assert.Equal(200, w.Code)
+		assert.Equal("0", w.Header().Get("X-Ratelimit-Remaining"))
+		assert.Equal("", w.Header().Get("Retry-After"))
+
+		w = get()
+		assert.Equal(429, w.Code)
+		assert.Equal("0", w.Header().Get("X-Ratelimit-Remaining"))
+		after, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		assert.Nil(err)
+		assert.True(after > 0 && after <= 60)
+	})
+}
@@ -0,0 +1,94 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// FairOptions for FairLimiter
+type FairOptions struct {
+	Max      int           // The global max count in duration shared by all ids, default is 100.
+	Duration time.Duration // The global count duration, default is 1 Minute.
+}
+
+// FairLimiter shares a global max count among ids in memory. In every window,
+// each active id (an id with requests in the window) gets an equal share of the max count,
+// so a heavy id is limited to its share even if the global max count is not used up.
+//
+// The set of active ids grows during the window, so the share is an approximation:
+// an id may use more than its final share before other ids become active,
+// the share only limits the requests after that.
+type FairLimiter struct {
+	max      int
+	duration time.Duration
+	used     int
+	expire   time.Time
+	counts   map[string]int
+	lock     sync.Mutex
+}
+
+// NewFair returns a FairLimiter instance with given options.
+func NewFair(opts FairOptions) *FairLimiter {
+	if opts.Max <= 0 {
+		opts.Max = 100
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = time.Minute
+	}
+	return &FairLimiter{
+		max:      opts.Max,
+		duration: opts.Duration,
+		counts:   make(map[string]int),
+	}
+}
+
+// Get get a limiter result for id. Result.Total is the current share of id.
+func (f *FairLimiter) Get(id string) (Result, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.rollover()
+
+	count, ok := f.counts[id]
+	if !ok {
+		f.counts[id] = 0
+	}
+	share := f.share()
+	result := Result{
+		Total:     share,
+		Remaining: -1,
+		Duration:  f.duration,
+		Reset:     f.expire,
+	}
+	if count < share && f.used < f.max {
+		count++
+		f.used++
+		f.counts[id] = count
+		result.Remaining = share - count
+	}
+	result.Used = count
+	return result, nil
+}
+
+// Remove remove limiter record for id, its requests still count in the global max count.
+func (f *FairLimiter) Remove(id string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.counts, id)
+	return nil
+}
+
+// share returns the count every active id can use in the window.
+func (f *FairLimiter) share() int {
+	active := len(f.counts)
+	return (f.max + active - 1) / active
+}
+
+func (f *FairLimiter) rollover() {
+	now := time.Now()
+	if f.expire.After(now) {
+		return
+	}
+	f.expire = now.Add(f.duration)
+	f.used = 0
+	f.counts = make(map[string]int)
+}
@@ -0,0 +1,88 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairLimiter(t *testing.T) {
+	t.Run("FairLimiter with one id should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewFair(FairOptions{Max: 3, Duration: 100 * time.Millisecond})
+		id := genID()
+
+		res, err := limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(2, res.Remaining)
+		assert.Equal(100*time.Millisecond, res.Duration)
+		assert.True(res.Reset.After(time.Now()))
+		limiter.Get(id)
+		res, _ = limiter.Get(id)
+		assert.Equal(0, res.Remaining)
+		res, _ = limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+
+		time.Sleep(res.Duration + time.Millisecond)
+		res, _ = limiter.Get(id)
+		assert.Equal(2, res.Remaining)
+	})
+
+	t.Run("FairLimiter with a heavy id should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewFair(FairOptions{Max: 10})
+		heavy := genID()
+		others := []string{genID(), genID(), genID()}
+		for _, id := range others {
+			limiter.Get(id)
+		}
+
+		// the heavy id gets its share only, 3 of 10 for 4 active ids
+		for i := 2; i >= 0; i-- {
+			res, _ := limiter.Get(heavy)
+			assert.Equal(3, res.Total)
+			assert.Equal(i, res.Remaining)
+		}
+		res, _ := limiter.Get(heavy)
+		assert.Equal(-1, res.Remaining)
+
+		// the other ids still get their shares
+		for _, id := range others {
+			res, _ := limiter.Get(id)
+			assert.Equal(1, res.Remaining)
+		}
+		res, _ = limiter.Get(others[0])
+		assert.Equal(0, res.Remaining)
+
+		// the global max count is used up
+		res, _ = limiter.Get(others[1])
+		assert.Equal(-1, res.Remaining)
+	})
+
+	t.Run("FairLimiter with a new active id should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewFair(FairOptions{Max: 4})
+		heavy := genID()
+		for i := 0; i < 3; i++ {
+			limiter.Get(heavy)
+		}
+
+		// the share shrinks when another id becomes active
+		res, _ := limiter.Get(genID())
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+		res, _ = limiter.Get(heavy)
+		assert.Equal(-1, res.Remaining)
+
+		// the removed requests still count in the global max count
+		assert.Nil(limiter.Remove(heavy))
+		res, _ = limiter.Get(genID())
+		assert.Equal(2, res.Total)
+		assert.Equal(-1, res.Remaining)
+	})
+}
@@ -0,0 +1,111 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// FloorOptions for FloorLimiter
+type FloorOptions struct {
+	Floor    int            // The guaranteed count in duration for every id, default is 10.
+	Floors   map[string]int // The guaranteed count of some ids, instead of Floor.
+	Pool     int            // The count in duration shared by all ids over their floors, default is 100.
+	Duration time.Duration  // The count duration, default is 1 Minute.
+}
+
+// FloorLimiter guarantees every id a floor count in memory, plus a burst pool shared by all ids.
+// In every window, a request of an id is first counted to its floor, and after the floor is used up,
+// to the shared pool. So an id can always use its floor, even if other ids have used up the pool.
+//
+// The floors are reserved besides the pool, so the limiter allows at most
+// Pool + the floors of the active ids in a window. Result.Total is the floor of id + Pool,
+// and Result.Remaining is the unused floor of id + the unused pool.
+type FloorLimiter struct {
+	floor    int
+	floors   map[string]int
+	pool     int
+	duration time.Duration
+	used     int
+	expire   time.Time
+	counts   map[string]int
+	lock     sync.Mutex
+}
+
+// NewFloor returns a FloorLimiter instance with given options.
+func NewFloor(opts FloorOptions) *FloorLimiter {
+	if opts.Floor <= 0 {
+		opts.Floor = 10
+	}
+	if opts.Pool <= 0 {
+		opts.Pool = 100
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = time.Minute
+	}
+	floors := make(map[string]int, len(opts.Floors))
+	for id, floor := range opts.Floors {
+		floors[id] = floor
+	}
+	return &FloorLimiter{
+		floor:    opts.Floor,
+		floors:   floors,
+		pool:     opts.Pool,
+		duration: opts.Duration,
+		counts:   make(map[string]int),
+	}
+}
+
+// Get get a limiter result for id.
+func (f *FloorLimiter) Get(id string) (Result, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.rollover()
+
+	floor, ok := f.floors[id]
+	if !ok {
+		floor = f.floor
+	}
+	count := f.counts[id]
+	result := Result{
+		Total:     floor + f.pool,
+		Remaining: -1,
+		Duration:  f.duration,
+		Reset:     f.expire,
+	}
+	switch {
+	case count < floor:
+		count++
+	case f.used < f.pool:
+		count++
+		f.used++
+	default:
+		result.Used = count
+		return result, nil
+	}
+	f.counts[id] = count
+
+	result.Remaining = f.pool - f.used
+	if count < floor {
+		result.Remaining += floor - count
+	}
+	result.Used = count
+	return result, nil
+}
+
+// Remove remove limiter record for id, its requests over the floor still count in the pool.
+func (f *FloorLimiter) Remove(id string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.counts, id)
+	return nil
+}
+
+func (f *FloorLimiter) rollover() {
+	now := time.Now()
+	if f.expire.After(now) {
+		return
+	}
+	f.expire = now.Add(f.duration)
+	f.used = 0
+	f.counts = make(map[string]int)
+}
@@ -0,0 +1,77 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloorLimiter(t *testing.T) {
+	t.Run("FloorLimiter with one id should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewFloor(FloorOptions{Floor: 2, Pool: 3, Duration: 100 * time.Millisecond})
+		id := genID()
+
+		res, err := limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(5, res.Total)
+		assert.Equal(4, res.Remaining)
+		assert.Equal(100*time.Millisecond, res.Duration)
+		assert.True(res.Reset.After(time.Now()))
+		for i := 3; i >= 0; i-- {
+			res, _ = limiter.Get(id)
+			assert.Equal(i, res.Remaining)
+		}
+		res, _ = limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(5, res.Used)
+
+		time.Sleep(res.Duration + time.Millisecond)
+		res, _ = limiter.Get(id)
+		assert.Equal(4, res.Remaining)
+	})
+
+	t.Run("FloorLimiter with an empty pool should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewFloor(FloorOptions{Floor: 3, Pool: 5, Floors: map[string]int{"vip": 6}})
+		heavy := genID()
+		for i := 0; i < 8; i++ {
+			res, _ := limiter.Get(heavy)
+			assert.Equal(7-i, res.Remaining)
+		}
+		res, _ := limiter.Get(heavy)
+		assert.Equal(-1, res.Remaining)
+
+		// the pool is empty, but every id can use its floor
+		for _, id := range []string{genID(), genID()} {
+			for i := 2; i >= 0; i-- {
+				res, _ = limiter.Get(id)
+				assert.Equal(8, res.Total)
+				assert.Equal(i, res.Remaining)
+			}
+			res, _ = limiter.Get(id)
+			assert.Equal(-1, res.Remaining)
+		}
+		for i := 5; i >= 0; i-- {
+			res, _ = limiter.Get("vip")
+			assert.Equal(11, res.Total)
+			assert.Equal(i, res.Remaining)
+		}
+		res, _ = limiter.Get("vip")
+		assert.Equal(-1, res.Remaining)
+	})
+
+	t.Run("FloorLimiter with default options should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewFloor(FloorOptions{})
+		res, _ := limiter.Get(genID())
+		assert.Equal(110, res.Total)
+		assert.Equal(109, res.Remaining)
+		assert.Equal(time.Minute, res.Duration)
+		assert.Nil(limiter.Remove(genID()))
+	})
+}
@@ -0,0 +1,35 @@
+package ratelimiter
+
+import "errors"
+
+// maxWindowHistorySize is the most windows Options.WindowHistorySize keeps.
+const maxWindowHistorySize = 64
+
+type historyReader interface {
+	windowHistory(key string) []int
+}
+
+// WindowHistory returns the used counts of the last completed windows of id, oldest first,
+// at most Options.WindowHistorySize of them, for a sparkline of recent usage. It is nil if id
+// has no limit record, or Options.WindowHistorySize is not set. A window is recorded when
+// the next Get of id starts a new one, so the windows without requests are skipped.
+// The history is best-effort: it is lost with the record, to Remove or the cleanup.
+// It is supported by the memory fixed window limiter only.
+func (l *Limiter) WindowHistory(id string) ([]int, error) {
+	h, ok := l.abstractLimiter.(historyReader)
+	if !ok {
+		return nil, errors.New("ratelimiter: window history is only supported by memory limiter")
+	}
+	return h.windowHistory(l.prefix + id), nil
+}
+
+// historyReader interface
+func (m *memoryLimiter) windowHistory(key string) []int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.store[key]
+	if !ok || len(item.history) == 0 {
+		return nil
+	}
+	return append([]int(nil), item.history...)
+}
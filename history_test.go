@@ -0,0 +1,76 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryWindowHistory(t *testing.T) {
+	t.Run("limiter.WindowHistory should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 5, Duration: 20 * time.Millisecond, WindowHistorySize: 3})
+		id := genID()
+		history, err := limiter.WindowHistory(id)
+		assert.Nil(err)
+		assert.Nil(history)
+
+		for _, count := range []int{1, 2, 7, 4, 3} {
+			for i := 0; i < count; i++ {
+				limiter.Get(id)
+			}
+			time.Sleep(25 * time.Millisecond)
+		}
+		history, _ = limiter.WindowHistory(id)
+		assert.Equal([]int{2, 5, 4}, history)
+
+		limiter.Get(id)
+		history, _ = limiter.WindowHistory(id)
+		assert.Equal([]int{5, 4, 3}, history)
+
+		// the returned history is a copy
+		history[0] = 0
+		history, _ = limiter.WindowHistory(id)
+		assert.Equal([]int{5, 4, 3}, history)
+
+		limiter.Remove(id)
+		history, _ = limiter.WindowHistory(id)
+		assert.Nil(history)
+	})
+
+	t.Run("limiter.PeekOrCreate should keep the ended window in the history", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 5, Duration: 20 * time.Millisecond, WindowHistorySize: 3})
+		id := genID()
+		for i := 0; i < 3; i++ {
+			limiter.Get(id)
+		}
+		time.Sleep(25 * time.Millisecond)
+		res, err := limiter.PeekOrCreate(id)
+		assert.Nil(err)
+		assert.Equal(5, res.Remaining)
+		history, _ := limiter.WindowHistory(id)
+		assert.Equal([]int{3}, history)
+	})
+
+	t.Run("limiter without WindowHistorySize should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Duration: 20 * time.Millisecond})
+		id := genID()
+		limiter.Get(id)
+		time.Sleep(25 * time.Millisecond)
+		limiter.Get(id)
+		history, err := limiter.WindowHistory(id)
+		assert.Nil(err)
+		assert.Nil(history)
+
+		limiter = New(Options{WindowHistorySize: 1000})
+		assert.Equal(maxWindowHistorySize, limiter.abstractLimiter.(*memoryLimiter).historySize)
+		_, err = New(Options{Algorithm: SlidingWindow}).WindowHistory(id)
+		assert.Equal("ratelimiter: window history is only supported by memory limiter", err.Error())
+	})
+}
@@ -0,0 +1,92 @@
+package ratelimiter
+
+import "time"
+
+// HybridOptions for HybridLimiter
+type HybridOptions struct {
+	Max          int           // The max count in Duration of the sliding window, default is 10.
+	Duration     time.Duration // The duration of the sliding window, default is 1 Second.
+	LongMax      int           // The max count in LongDuration of the fixed window, default is 10000.
+	LongDuration time.Duration // The duration of the fixed window, default is 24 Hours.
+	Prefix       string        // Redis key prefix, default is "LIMIT:".
+	Client       RedisClient   // Use a redis client for limiter, if omit, it will use memory limiters.
+}
+
+// HybridLimiter enforces a short sliding window and a long fixed window together,
+// such as 10 requests per second without boundary bursts and 10000 requests per day.
+//
+// The sliding window keeps up to Max members per id and the fixed window keeps one
+// hash per id, so an id costs up to Max + 1 records in memory or redis.
+type HybridLimiter struct {
+	short *Limiter
+	long  *Limiter
+}
+
+// NewHybrid returns a HybridLimiter instance with given options.
+func NewHybrid(opts HybridOptions) *HybridLimiter {
+	if opts.Prefix == "" {
+		opts.Prefix = "LIMIT:"
+	}
+	if opts.Max <= 0 {
+		opts.Max = 10
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = time.Second
+	}
+	if opts.LongMax <= 0 {
+		opts.LongMax = 10000
+	}
+	if opts.LongDuration <= 0 {
+		opts.LongDuration = 24 * time.Hour
+	}
+	return &HybridLimiter{
+		short: New(Options{
+			Max:       opts.Max,
+			Duration:  opts.Duration,
+			Prefix:    opts.Prefix + "sliding:",
+			Client:    opts.Client,
+			Algorithm: SlidingWindow,
+		}),
+		long: New(Options{
+			Max:      opts.LongMax,
+			Duration: opts.LongDuration,
+			Prefix:   opts.Prefix + "fixed:",
+			Client:   opts.Client,
+		}),
+	}
+}
+
+// Get get the most restrictive limiter result of the two windows for id.
+// A request denied by the sliding window is not counted by the fixed window,
+// but a request allowed by the sliding window is counted by it even if the fixed window denies it.
+func (h *HybridLimiter) Get(id string) (Result, error) {
+	short, err := h.short.Get(id)
+	if err != nil || short.Remaining < 0 {
+		return short, err
+	}
+	long, err := h.long.Get(id)
+	if err != nil {
+		return long, err
+	}
+	if long.Remaining < short.Remaining {
+		return long, nil
+	}
+	return short, nil
+}
+
+// Remove remove limiter records of the two windows for id
+func (h *HybridLimiter) Remove(id string) error {
+	if err := h.short.Remove(id); err != nil {
+		return err
+	}
+	return h.long.Remove(id)
+}
+
+// Close closes the limiters of the two windows, see Limiter.Close.
+func (h *HybridLimiter) Close() error {
+	err := h.short.Close()
+	if e := h.long.Close(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHybridLimiter(t *testing.T) {
+	t.Run("HybridLimiter with default options should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewHybrid(HybridOptions{})
+		res, err := limiter.Get(genID())
+		assert.Nil(err)
+		assert.Equal(10, res.Total)
+		assert.Equal(9, res.Remaining)
+		assert.Equal(time.Second, res.Duration)
+	})
+
+	t.Run("HybridLimiter should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := NewHybrid(HybridOptions{
+			Max:          3,
+			Duration:     100 * time.Millisecond,
+			LongMax:      5,
+			LongDuration: time.Second,
+		})
+		id := genID()
+
+		for i := 2; i >= 0; i-- {
+			res, err := limiter.Get(id)
+			assert.Nil(err)
+			assert.Equal(i, res.Remaining)
+		}
+
+		// a burst is denied by the sliding window
+		res, err := limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(100*time.Millisecond, res.Duration)
+
+		// sustained usage is denied by the fixed window
+		time.Sleep(110 * time.Millisecond)
+		res, _ = limiter.Get(id)
+		assert.Equal(5, res.Total)
+		assert.Equal(1, res.Remaining)
+		res, _ = limiter.Get(id)
+		assert.Equal(0, res.Remaining)
+		res, _ = limiter.Get(id)
+		assert.Equal(5, res.Total)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(time.Second, res.Duration)
+
+		time.Sleep(110 * time.Millisecond)
+		res, _ = limiter.Get(id)
+		assert.Equal(5, res.Total)
+		assert.Equal(-1, res.Remaining)
+
+		assert.Nil(limiter.Remove(id))
+		res, _ = limiter.Get(id)
+		assert.Equal(3, res.Total)
+		assert.Equal(2, res.Remaining)
+	})
+}
@@ -0,0 +1,52 @@
+package ratelimiter
+
+import (
+	"errors"
+	"time"
+)
+
+type lastAccessReader interface {
+	lastAccess(key string) (time.Time, bool, error)
+}
+
+// LastAccess returns the time of the last Get of id, and false if id has no limit record
+// or it has not been accessed since it was blocked. A redis limiter stores the time in milliseconds.
+// It is supported by fixed window limiters only.
+func (l *Limiter) LastAccess(id string) (time.Time, bool, error) {
+	r, ok := l.abstractLimiter.(lastAccessReader)
+	if !ok {
+		return time.Time{}, false, errors.New("ratelimiter: last access is only supported by fixed window limiter")
+	}
+	return r.lastAccess(l.prefix + id)
+}
+
+// lastAccessReader interface
+func (m *memoryLimiter) lastAccess(key string) (time.Time, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.store[key]
+	if !ok || item.lastAccess.IsZero() {
+		return time.Time{}, false, nil
+	}
+	return item.lastAccess, true, nil
+}
+
+// lastAccessReader interface
+func (r *redisLimiter) lastAccess(key string) (time.Time, bool, error) {
+	res, err := evalScript(r.rc, r.lastAccessSha1, lastAccessLua, []string{key})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	timestamp, ok := res.(int64)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	sec := timestamp / 1000
+	return time.Unix(sec, (timestamp-(sec*1000))*1e6), true, nil
+}
+
+const lastAccessLua string = `
+-- KEYS[1] target hash key
+
+return tonumber(redis.call('hget', KEYS[1], 'la'))
+`
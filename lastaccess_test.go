@@ -0,0 +1,54 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLastAccess(t *testing.T) {
+	t.Run("limiter.LastAccess should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+
+		_, ok, err := limiter.LastAccess(id)
+		assert.Nil(err)
+		assert.False(ok)
+
+		start := time.Now()
+		limiter.Get(id)
+		first, ok, err := limiter.LastAccess(id)
+		assert.Nil(err)
+		assert.True(ok)
+		assert.False(first.Before(start))
+
+		time.Sleep(10 * time.Millisecond)
+		limiter.Get(id)
+		last, ok, _ := limiter.LastAccess(id)
+		assert.True(ok)
+		assert.True(last.After(first))
+
+		limiter.Remove(id)
+		_, ok, _ = limiter.LastAccess(id)
+		assert.False(ok)
+
+		// a blocked id is not accessed
+		limiter.Block(id, time.Minute)
+		_, ok, _ = limiter.LastAccess(id)
+		assert.False(ok)
+		limiter.Get(id)
+		_, ok, _ = limiter.LastAccess(id)
+		assert.True(ok)
+	})
+
+	t.Run("limiter.LastAccess with sliding window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow})
+		_, _, err := limiter.LastAccess(genID())
+		assert.Equal("ratelimiter: last access is only supported by fixed window limiter", err.Error())
+	})
+}
@@ -1,7 +1,7 @@
 package ratelimiter
 
 import (
-	"errors"
+	"math/rand"
 	"sync"
 	"time"
 )
@@ -10,6 +10,8 @@ import (
 type statusCacheItem struct {
 	index  int
 	expire time.Time
+	// topHits is the count of used-up windows of the last tier, see Options.TopTierBlockCount.
+	topHits int
 }
 
 // limit status
@@ -18,6 +20,17 @@ type limiterCacheItem struct {
 	remaining int
 	duration  time.Duration
 	expire    time.Time
+	meta      []byte
+	firstSeen time.Time
+	stats     KeyStats
+	// lastAccess is the time of the last Get, zero if the record is created by Block.
+	lastAccess time.Time
+	// history is the used counts of the last completed windows, see Options.WindowHistorySize.
+	history []int
+	// overflow is the count of denied requests in the window, see Options.OverLimitRemaining.
+	overflow int
+	// allowed is the count of allowed requests in the window, see Result.Used.
+	allowed int
 }
 
 type memoryLimiter struct {
@@ -25,42 +38,125 @@ type memoryLimiter struct {
 	duration time.Duration
 	status   map[string]*statusCacheItem
 	store    map[string]*limiterCacheItem
+	distinct map[string]*distinctItem
 	ticker   *time.Ticker
 	lock     sync.Mutex
+	jitter   int
+	rand     *rand.Rand
+
+	// key count high-water mark, see Options.KeyCountAlertThreshold.
+	alertThreshold  int
+	onHighWaterMark func(count int)
+	alerted         bool
+
+	onSweep func(stats SweepStats)
+
+	maxActiveKeys int
+
+	topBlockCount   int
+	topBlockPenalty time.Duration
+
+	escalationCooldown time.Duration
+	// cooldowns are the ends of the escalation cooldowns by status key, they are kept apart
+	// from the status as the redis cooldown key, see Options.EscalationCooldown.
+	cooldowns   map[string]time.Time
+	stateTTL    time.Duration
+	historySize int
+
+	// drained refuses new windows, see Limiter.Drain.
+	drained bool
+	closed  bool
+	done    chan struct{}
 }
 
-func newMemoryLimiter(opts *Options) *Limiter {
+func newMemoryLimiter(opts *Options) *memoryLimiter {
 	m := &memoryLimiter{
 		max:      opts.Max,
 		duration: opts.Duration,
 		store:    make(map[string]*limiterCacheItem),
 		status:   make(map[string]*statusCacheItem),
-		ticker:   time.NewTicker(time.Second),
+		distinct: make(map[string]*distinctItem),
+		jitter:   opts.DebugRemainingJitter,
+		rand:     opts.Rand,
+
+		alertThreshold:  opts.KeyCountAlertThreshold,
+		onHighWaterMark: opts.OnHighWaterMark,
+
+		onSweep:       opts.OnSweep,
+		maxActiveKeys: opts.MaxActiveKeys,
+
+		topBlockCount:   opts.TopTierBlockCount,
+		topBlockPenalty: opts.TopTierBlockPenalty,
+
+		escalationCooldown: opts.EscalationCooldown,
+		cooldowns:          make(map[string]time.Time),
+		stateTTL:           opts.StateTTL,
+		historySize:        opts.WindowHistorySize,
+	}
+	if m.jitter > 0 && m.rand == nil {
+		m.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if !opts.DisableBackgroundCleanup {
+		m.ticker = time.NewTicker(time.Second)
+		m.done = make(chan struct{})
+		go m.cleanCache()
 	}
-	go m.cleanCache()
-	return &Limiter{m, opts.Prefix}
+	return m
 }
 
 // abstractLimiter interface
 func (m *memoryLimiter) getLimit(key string, policy ...int) ([]interface{}, error) {
-	length := len(policy)
-	var args []int
-	if length == 0 {
-		args = []int{m.max, int(m.duration / time.Millisecond)}
-	} else {
-		args = make([]int, length)
-		for i, val := range policy {
-			if val <= 0 {
-				return nil, errors.New("ratelimiter: must be positive integer")
-			}
-			args[i] = policy[i]
-		}
+	args, err := m.limitArgs(policy...)
+	if err != nil {
+		return nil, err
 	}
 
-	res := m.getItem(key, args...)
+	// the result is read under the same lock as the update,
+	// so a concurrent Get or Remove can't change it in between.
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	return []interface{}{res.remaining, res.total, res.duration, res.expire}, nil
+	if err := m.admit(key); err != nil {
+		return nil, err
+	}
+	return m.getItem(key, args...).result(), nil
+}
+
+// admit returns ErrDrained if key has no live window and the limiter is drained,
+// or ErrTooManyKeys if key is new and there are MaxActiveKeys records,
+// it must be called with m.lock held.
+func (m *memoryLimiter) admit(key string) error {
+	if m.drained {
+		if item, ok := m.store[key]; !ok || !item.expire.After(time.Now()) {
+			return ErrDrained
+		}
+		return nil
+	}
+	if m.maxActiveKeys <= 0 || len(m.store) < m.maxActiveKeys {
+		return nil
+	}
+	if _, ok := m.store[key]; !ok {
+		return ErrTooManyKeys
+	}
+	return nil
+}
+
+// limitArgs returns the policy args for getItem.
+func (m *memoryLimiter) limitArgs(policy ...int) ([]int, error) {
+	if len(policy) == 0 {
+		return []int{m.max, int(m.duration / time.Millisecond)}, nil
+	}
+	if err := ValidatePolicy(policy...); err != nil {
+		return nil, err
+	}
+	return append([]int(nil), policy...), nil
+}
+
+// result returns the result slice of the item, it must be called with m.lock held.
+// The meta is copied, so the caller can't change the stored one.
+func (res *limiterCacheItem) result() []interface{} {
+	first := res.expire.Add(-res.duration).Equal(res.firstSeen)
+	meta := append([]byte(nil), res.meta...)
+	return []interface{}{res.remaining, res.total, res.duration, res.expire, meta, first, res.overflow, res.allowed}
 }
 
 // abstractLimiter interface
@@ -70,25 +166,60 @@ func (m *memoryLimiter) removeLimit(key string) error {
 	defer m.lock.Unlock()
 	delete(m.store, key)
 	delete(m.status, statusKey)
+	delete(m.cooldowns, statusKey)
+	m.rearmHighWaterMark()
 	return nil
 }
 
 func (m *memoryLimiter) clean() {
+	var stats SweepStats
+	if m.onSweep != nil {
+		begin := time.Now()
+		// the callback runs after the lock is released.
+		defer func() {
+			stats.Duration = time.Since(begin)
+			m.onSweep(stats)
+		}()
+	}
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	start := time.Now()
 	expireTime := start.Add(time.Millisecond * 100)
 	frequency := 24
 	var expired int
+	defer m.rearmHighWaterMark()
 	for {
 	label:
 		for i := 0; i < frequency; i++ {
 			for key, value := range m.store {
-				if value.expire.Add(value.duration).Before(start) {
+				stats.Examined++
+				if value.expire.Add(m.grace(value)).Before(start) {
 					statusKey := "{" + key + "}:S"
 					delete(m.store, key)
-					delete(m.status, statusKey)
+					// the policy status may outlive the record, as redis status key does.
+					if status, ok := m.status[statusKey]; ok && status.expire.Before(start) {
+						delete(m.status, statusKey)
+					}
 					expired++
+					stats.Evicted++
+				}
+				break
+			}
+			for key, value := range m.status {
+				if value.expire.Before(start) {
+					delete(m.status, key)
+				}
+				break
+			}
+			for key, value := range m.distinct {
+				if value.expire.Before(start) {
+					delete(m.distinct, key)
+				}
+				break
+			}
+			for key, until := range m.cooldowns {
+				if until.Before(start) {
+					delete(m.cooldowns, key)
 				}
 				break
 			}
@@ -104,35 +235,75 @@ func (m *memoryLimiter) clean() {
 	}
 }
 
+// getItem must be called with m.lock held.
 func (m *memoryLimiter) getItem(key string, args ...int) (res *limiterCacheItem) {
 	policyCount := len(args) / 2
 	statusKey := "{" + key + "}:S"
+	if m.stateTTL > 0 {
+		defer func() { m.touchStatus(statusKey, res) }()
+	}
 
-	m.lock.Lock()
-	defer m.lock.Unlock()
 	var ok bool
 	if res, ok = m.store[key]; !ok {
+		// the policy status may outlive the record, as redis status key does.
+		index := m.policyIndex(statusKey, policyCount)
+		total := args[(index*2)-2]
+		duration := time.Duration(args[(index*2)-1]) * time.Millisecond
+		now := time.Now()
 		res = &limiterCacheItem{
-			total:     args[0],
-			remaining: args[0] - 1,
-			duration:  time.Duration(args[1]) * time.Millisecond,
-			expire:    time.Now().Add(time.Duration(args[1]) * time.Millisecond),
+			total:      total,
+			remaining:  total - 1,
+			duration:   duration,
+			expire:     now.Add(duration),
+			firstSeen:  now,
+			stats:      KeyStats{Allowed: 1},
+			lastAccess: now,
+			allowed:    1,
+		}
+		if jitter := m.jitter; jitter > 0 {
+			if jitter > res.remaining {
+				jitter = res.remaining
+			}
+			res.remaining -= m.rand.Intn(jitter + 1)
 		}
 		m.store[key] = res
+		m.checkHighWaterMark()
 		return
 	}
+	res.lastAccess = time.Now()
 	if res.expire.After(time.Now()) {
+		blocked := false
 		if policyCount > 1 && res.remaining-1 == -1 {
 			statusItem, ok := m.status[statusKey]
 			if ok {
+				// an expired status starts again, as redis status key does.
+				if statusItem.expire.Before(time.Now()) {
+					statusItem.index = 1
+					statusItem.topHits = 0
+				}
+				// the window is at the top tier if the status has reached it.
+				if m.topBlockCount > 0 && statusItem.index >= policyCount {
+					statusItem.topHits++
+					if statusItem.topHits >= m.topBlockCount {
+						statusItem.topHits = 0
+						blocked = true
+					}
+				}
 				statusItem.expire = time.Now().Add(res.duration * 2)
-				statusItem.index++
-			} else {
+				if m.escalate(statusKey) {
+					// the index goes on past the last tier for the top tier block, but it is not a tier change.
+					if statusItem.index < policyCount {
+						res.stats.Escalations++
+					}
+					statusItem.index++
+				}
+			} else if m.escalate(statusKey) {
 				statusItem := &statusCacheItem{
 					index:  2,
-					expire: time.Now().Add(time.Duration(args[1]) * time.Millisecond * 2),
+					expire: time.Now().Add(res.duration * 2),
 				}
 				m.status[statusKey] = statusItem
+				res.stats.Escalations++
 			}
 		}
 		if res.remaining >= 0 {
@@ -140,32 +311,127 @@ func (m *memoryLimiter) getItem(key string, args ...int) (res *limiterCacheItem)
 		} else {
 			res.remaining = -1
 		}
+		if res.remaining >= 0 {
+			res.stats.Allowed++
+			res.allowed++
+		} else {
+			res.stats.Denied++
+			res.overflow++
+		}
+		if blocked {
+			res.duration = m.topBlockPenalty
+			res.expire = time.Now().Add(m.topBlockPenalty)
+			res.overflow = 1
+		}
 	} else {
-		index := 1
-		if policyCount > 1 {
-			if statusItem, ok := m.status[statusKey]; ok {
-				if statusItem.expire.Before(time.Now()) {
-					index = 1
-				} else if statusItem.index > policyCount {
-					index = policyCount
-				} else {
-					index = statusItem.index
-				}
-				statusItem.index = index
+		index := m.policyIndex(statusKey, policyCount)
+		m.rollover(res, args[(index*2)-2], time.Duration(args[(index*2)-1])*time.Millisecond, time.Now())
+		res.remaining--
+		res.stats.Allowed++
+		res.allowed++
+	}
+	return
+}
+
+// grace returns how long clean keeps the expired item res, the duration of its window or StateTTL.
+func (m *memoryLimiter) grace(res *limiterCacheItem) time.Duration {
+	if m.stateTTL > 0 {
+		return m.stateTTL
+	}
+	return res.duration
+}
+
+// rollover starts a new window of total and duration for the expired item res, and keeps
+// the allowed count of the ended window in the history. It must be called with m.lock held.
+func (m *memoryLimiter) rollover(res *limiterCacheItem, total int, duration time.Duration, now time.Time) {
+	if m.historySize > 0 {
+		res.history = append(res.history, res.allowed)
+		if len(res.history) > m.historySize {
+			res.history = res.history[1:]
+		}
+	}
+	// the id is new again when clean would have dropped it, as redis seen key expires.
+	if res.expire.Add(m.grace(res)).Before(now) {
+		res.firstSeen = now
+	}
+	res.total = total
+	res.remaining = total
+	res.duration = duration
+	res.expire = now.Add(duration)
+	res.overflow = 0
+	res.allowed = 0
+	res.stats.Rollovers++
+}
+
+// escalate returns false if statusKey is in the escalation cooldown, or it starts the cooldown
+// and returns true, an escalation step starts the cooldown and until then the id keeps its tier.
+// It must be called with m.lock held.
+func (m *memoryLimiter) escalate(statusKey string) bool {
+	if m.escalationCooldown <= 0 {
+		return true
+	}
+	now := time.Now()
+	if until, ok := m.cooldowns[statusKey]; ok && until.After(now) {
+		return false
+	}
+	m.cooldowns[statusKey] = now.Add(m.escalationCooldown)
+	return true
+}
+
+// policyIndex returns the policy index for a new window, it must be called with m.lock held.
+func (m *memoryLimiter) policyIndex(statusKey string, policyCount int) int {
+	index := 1
+	if policyCount > 1 {
+		if statusItem, ok := m.status[statusKey]; ok {
+			if statusItem.expire.Before(time.Now()) {
+				index = 1
+			} else if statusItem.index > policyCount {
+				index = policyCount
+			} else {
+				index = statusItem.index
 			}
+			statusItem.index = index
 		}
-		total := args[(index*2)-2]
-		duration := args[(index*2)-1]
-		res.total = total
-		res.remaining = total - 1
-		res.duration = time.Duration(duration) * time.Millisecond
-		res.expire = time.Now().Add(time.Duration(duration) * time.Millisecond)
 	}
-	return
+	return index
+}
+
+// touchStatus keeps the live policy status of key for StateTTL after the window res,
+// it must be called with m.lock held.
+func (m *memoryLimiter) touchStatus(statusKey string, res *limiterCacheItem) {
+	if statusItem, ok := m.status[statusKey]; ok && statusItem.expire.After(time.Now()) {
+		statusItem.expire = res.expire.Add(m.stateTTL)
+	}
+}
+
+// checkHighWaterMark fires OnHighWaterMark once when the key count exceeds the threshold,
+// it must be called with m.lock held after a record is added.
+func (m *memoryLimiter) checkHighWaterMark() {
+	if m.alertThreshold <= 0 || m.onHighWaterMark == nil || m.alerted {
+		return
+	}
+	if count := len(m.store); count > m.alertThreshold {
+		m.alerted = true
+		// the callback runs without the lock, so it may call the limiter.
+		go m.onHighWaterMark(count)
+	}
+}
+
+// rearmHighWaterMark re-arms OnHighWaterMark when the key count drops to the threshold,
+// it must be called with m.lock held after records are removed.
+func (m *memoryLimiter) rearmHighWaterMark() {
+	if m.alerted && len(m.store) <= m.alertThreshold {
+		m.alerted = false
+	}
 }
 
 func (m *memoryLimiter) cleanCache() {
-	for range m.ticker.C {
-		m.clean()
+	for {
+		select {
+		case <-m.ticker.C:
+			m.clean()
+		case <-m.done:
+			return
+		}
 	}
 }
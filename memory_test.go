@@ -1,12 +1,17 @@
 package ratelimiter
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
+	mathrand "math/rand"
+	"runtime"
+	"sort"
 	"testing"
 	"time"
 
 	"sync"
+	"sync/atomic"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -631,6 +636,992 @@ func TestMemoryRateLimiter(t *testing.T) {
 
 	})
 }
+
+func TestMemoryResultUsed(t *testing.T) {
+	t.Run("Result.Used should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{3, 100}
+
+		allowed := 0
+		for i := 0; i < 6; i++ {
+			res, err := limiter.Get(id, policy...)
+			assert.Nil(err)
+			if res.Remaining >= 0 {
+				allowed++
+			}
+			assert.Equal(allowed, res.Used)
+		}
+		assert.Equal(3, allowed)
+
+		time.Sleep(100*time.Millisecond + time.Millisecond)
+		res, _ := limiter.Get(id, policy...)
+		assert.Equal(1, res.Used)
+	})
+
+	t.Run("Result.Used with sliding window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow, Max: 2})
+		id := genID()
+
+		res, _ := limiter.Get(id)
+		assert.Equal(1, res.Used)
+		res, _ = limiter.Get(id)
+		assert.Equal(2, res.Used)
+		res, _ = limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(2, res.Used)
+	})
+}
+
+func TestMemoryRemainingJitter(t *testing.T) {
+	t.Run("limiter with DebugRemainingJitter should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{
+			DebugRemainingJitter: 5,
+			Rand:                 mathrand.New(mathrand.NewSource(1)),
+		})
+		policy := []int{10, 1000}
+
+		seen := make(map[int]bool)
+		for i := 0; i < 100; i++ {
+			res, err := limiter.Get(genID(), policy...)
+			assert.Nil(err)
+			assert.Equal(10, res.Total)
+			assert.True(res.Remaining >= 4 && res.Remaining <= 9)
+			seen[res.Remaining] = true
+		}
+		assert.Equal(6, len(seen))
+
+		// the jitter never makes remaining negative
+		res, _ := New(Options{DebugRemainingJitter: 5}).Get(genID(), 2, 1000)
+		assert.True(res.Remaining >= 0 && res.Remaining <= 1)
+	})
+
+	t.Run("limiter with the same Rand seed should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		a := New(Options{DebugRemainingJitter: 50, Rand: mathrand.New(mathrand.NewSource(7))})
+		b := New(Options{DebugRemainingJitter: 50, Rand: mathrand.New(mathrand.NewSource(7))})
+		for i := 0; i < 10; i++ {
+			resA, _ := a.Get(genID())
+			resB, _ := b.Get(genID())
+			assert.Equal(resA.Remaining, resB.Remaining)
+		}
+	})
+}
+
+func TestMemoryFirstWindow(t *testing.T) {
+	t.Run("Result.FirstWindow should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{2, 100}
+
+		res, _ := limiter.Get(id, policy...)
+		assert.True(res.FirstWindow)
+		res, _ = limiter.Get(id, policy...)
+		assert.True(res.FirstWindow)
+
+		time.Sleep(res.Duration + time.Millisecond)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(1, res.Remaining)
+		assert.False(res.FirstWindow)
+		res, _ = limiter.Get(id, policy...)
+		assert.False(res.FirstWindow)
+
+		limiter.Remove(id)
+		res, _ = limiter.Get(id, policy...)
+		assert.True(res.FirstWindow)
+	})
+
+	t.Run("Result.FirstWindow with snapshot should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		limiter := New(Options{SnapshotWriter: &buf})
+		id := genID()
+		limiter.Get(id)
+		assert.Nil(limiter.Flush())
+
+		restored := New(Options{})
+		assert.Nil(restored.RestoreFrom(&buf))
+		res, _ := restored.Get(id)
+		assert.Equal(98, res.Remaining)
+		assert.True(res.FirstWindow)
+	})
+}
+
+func TestMemorySerializeAll(t *testing.T) {
+	t.Run("limiter with SerializeAll should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		policy := []int{50, 10000}
+		concurrent := New(Options{SerializeAll: true})
+		sequential := New(Options{})
+		id := genID()
+
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		got := make([]int, 0, 100)
+		wg.Add(100)
+		for i := 0; i < 100; i++ {
+			go func() {
+				defer wg.Done()
+				res, err := concurrent.Get(id, policy...)
+				assert.Nil(err)
+				lock.Lock()
+				got = append(got, res.Remaining)
+				lock.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		want := make([]int, 0, 100)
+		for i := 0; i < 100; i++ {
+			res, _ := sequential.Get(id, policy...)
+			want = append(want, res.Remaining)
+		}
+		sort.Ints(got)
+		sort.Ints(want)
+		assert.Equal(want, got)
+		assert.Nil(concurrent.Remove(id))
+	})
+}
+
+func TestMemoryGetIf(t *testing.T) {
+	t.Run("limiter.GetIf should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 5})
+		id := genID()
+
+		res, err := limiter.GetIf(true, id)
+		assert.Nil(err)
+		assert.Equal(4, res.Remaining)
+
+		// nothing is consumed if cond is false
+		for i := 0; i < 10; i++ {
+			res, err = limiter.GetIf(false, id)
+			assert.Nil(err)
+			assert.Equal(5, res.Total)
+			assert.Equal(5, res.Remaining)
+			assert.Equal(0, res.Used)
+			assert.Equal(time.Minute, res.Duration)
+		}
+		res, err = limiter.GetIf(false, id, 3, 1000)
+		assert.Equal(3, res.Total)
+		assert.Equal(3, res.Remaining)
+		assert.Equal(time.Second, res.Duration)
+
+		res, err = limiter.GetIf(true, id)
+		assert.Equal(3, res.Remaining)
+
+		_, err = limiter.GetIf(false, id, 3)
+		assert.Equal("ratelimiter: must be paired values", err.Error())
+		_, err = limiter.GetIf(false, id, 0, 1000)
+		assert.Equal("ratelimiter: must be positive integer", err.Error())
+	})
+}
+
+func TestMemoryConcurrentRemove(t *testing.T) {
+	t.Run("concurrent limiter.Get should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{200, 10000}
+
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		seen := make(map[int]bool)
+		wg.Add(100)
+		for i := 0; i < 100; i++ {
+			go func() {
+				defer wg.Done()
+				res, _ := limiter.Get(id, policy...)
+				lock.Lock()
+				defer lock.Unlock()
+				// every Get reports its own decrement
+				assert.False(seen[res.Remaining])
+				seen[res.Remaining] = true
+			}()
+		}
+		wg.Wait()
+		assert.Equal(100, len(seen))
+	})
+
+	t.Run("limiter.Remove with concurrent limiter.Get should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{10, 10000, 5, 10000}
+
+		var wg sync.WaitGroup
+		wg.Add(200)
+		for i := 0; i < 200; i++ {
+			go func(i int) {
+				defer wg.Done()
+				if i%10 == 0 {
+					assert.Nil(limiter.Remove(id))
+					return
+				}
+				res, err := limiter.Get(id, policy...)
+				assert.Nil(err)
+				assert.True(res.Remaining >= -1 && res.Remaining < res.Total)
+			}(i)
+		}
+		wg.Wait()
+
+		// a Remove is never lost to an in-flight Get
+		assert.Nil(limiter.Remove(id))
+		res, _ := limiter.Get(id, policy...)
+		assert.Equal(10, res.Total)
+		assert.Equal(9, res.Remaining)
+		assert.True(res.FirstWindow)
+	})
+}
+
+func TestMemoryHotKey(t *testing.T) {
+	t.Run("concurrent limiter.Get over the limit should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// the exhaustion boundary is crossed under the lock: one escalation, and exact counts.
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{500, 10000, 100, 10000}
+
+		var allowed, denied int64
+		var wg sync.WaitGroup
+		wg.Add(50)
+		for i := 0; i < 50; i++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					res, _ := limiter.Get(id, policy...)
+					if res.Allowed() {
+						atomic.AddInt64(&allowed, 1)
+					} else {
+						atomic.AddInt64(&denied, 1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(int64(500), allowed)
+		assert.Equal(int64(500), denied)
+		stats, _, _ := limiter.KeyStats(id)
+		assert.Equal(KeyStats{Allowed: 500, Denied: 500, Escalations: 1}, stats)
+	})
+}
+
+func TestMemoryStatus(t *testing.T) {
+	t.Run("escalation with expired status should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{1, 100, 1, 300, 1, 100}
+
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+		time.Sleep(110 * time.Millisecond)
+		res, _ := limiter.Get(id, policy...)
+		assert.Equal(time.Millisecond*300, res.Duration)
+
+		// the status has expired, escalation starts again from the first tier
+		time.Sleep(240 * time.Millisecond)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+		time.Sleep(res.Duration)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(time.Millisecond*300, res.Duration)
+	})
+
+	t.Run("clean with escalated status should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := newMemoryLimiter(&Options{Max: 1, Duration: time.Second})
+		id := genID()
+		policy := []int{1, 50, 1, 100}
+
+		limiter.getLimit(id, policy...)
+		time.Sleep(40 * time.Millisecond)
+		limiter.getLimit(id, policy...)
+
+		// the record is cleaned, but the status is kept until it expires
+		time.Sleep(70 * time.Millisecond)
+		limiter.clean()
+		assert.Equal(0, len(limiter.store))
+		assert.Equal(1, len(limiter.status))
+		res, _ := limiter.getLimit(id, policy...)
+		assert.Equal(time.Millisecond*100, res[2].(time.Duration))
+
+		time.Sleep(210 * time.Millisecond)
+		limiter.clean()
+		assert.Equal(0, len(limiter.status))
+	})
+}
+
+func TestMemorySoftRatio(t *testing.T) {
+	t.Run("limiter with SoftRatio should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{SoftRatio: 0.6})
+		id := genID()
+		policy := []int{5, 1000}
+
+		for i := 1; i <= 3; i++ {
+			res, err := limiter.Get(id, policy...)
+			assert.Nil(err)
+			assert.False(res.SoftExceeded, "request %d", i)
+			assert.False(res.HardExceeded)
+		}
+		for i := 4; i <= 5; i++ {
+			res, err := limiter.Get(id, policy...)
+			assert.Nil(err)
+			assert.True(res.Remaining >= 0)
+			assert.True(res.SoftExceeded, "request %d", i)
+			assert.False(res.HardExceeded)
+		}
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(-1, res.Remaining)
+		assert.False(res.SoftExceeded)
+		assert.True(res.HardExceeded)
+	})
+
+	t.Run("ratelimiter.New with SoftRatio out of range should panic", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, ratio := range []float64{-0.1, 1, 1.5} {
+			assert.Panics(func() {
+				New(Options{SoftRatio: ratio})
+			}, "SoftRatio %v", ratio)
+		}
+		assert.NotPanics(func() { New(Options{SoftRatio: 0.99}) })
+	})
+
+	t.Run("limiter without SoftRatio should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 1})
+		id := genID()
+		res, _ := limiter.Get(id)
+		assert.False(res.SoftExceeded)
+		assert.False(res.HardExceeded)
+		res, _ = limiter.Get(id)
+		assert.False(res.SoftExceeded)
+		assert.True(res.HardExceeded)
+	})
+}
+
+func TestMemoryDisableBackgroundCleanup(t *testing.T) {
+	t.Run("ratelimiter.New with DisableBackgroundCleanup should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, algorithm := range []Algorithm{FixedWindow, SlidingWindow, Credits} {
+			count := runtime.NumGoroutine()
+			New(Options{Algorithm: algorithm, DisableBackgroundCleanup: true})
+			assert.Equal(count, runtime.NumGoroutine())
+		}
+	})
+
+	t.Run("limiter.Get with DisableBackgroundCleanup should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{DisableBackgroundCleanup: true})
+		backend := limiter.abstractLimiter.(*memoryLimiter)
+		id := genID()
+		policy := []int{2, 50}
+
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+		res, _ := limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+
+		// the expired record stays until it is accessed again
+		time.Sleep(1100 * time.Millisecond)
+		assert.Equal(1, len(backend.store))
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+		assert.True(res.Reset.After(time.Now()))
+	})
+}
+
+func TestMemoryProbeKeys(t *testing.T) {
+	t.Run("limiter.Get with ProbeKeys should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		probe := genID()
+		limiter := New(Options{Max: 1, ProbeKeys: []string{probe}})
+		backend := limiter.abstractLimiter.(*memoryLimiter)
+
+		for i := 0; i < 3; i++ {
+			res, err := limiter.Get(probe)
+			assert.Nil(err)
+			assert.Equal(1, res.Total)
+			assert.Equal(1, res.Remaining)
+			assert.Equal(0, res.Used)
+			assert.False(res.HardExceeded)
+			assert.True(res.Reset.After(time.Now()))
+		}
+		assert.Equal(0, len(backend.store))
+
+		// the backend is still called
+		_, err := limiter.Get(probe, 1, 0)
+		assert.Equal("ratelimiter: must be positive integer", err.Error())
+
+		id := genID()
+		res, _ := limiter.Get(id)
+		assert.Equal(0, res.Remaining)
+		res, _ = limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+	})
+}
+
+func TestMemoryHighWaterMark(t *testing.T) {
+	t.Run("limiter with KeyCountAlertThreshold should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		counts := make(chan int, 10)
+		limiter := New(Options{
+			KeyCountAlertThreshold:   3,
+			OnHighWaterMark:          func(count int) { counts <- count },
+			DisableBackgroundCleanup: true,
+		})
+		ids := []string{genID(), genID(), genID(), genID(), genID()}
+
+		for _, id := range ids[:3] {
+			limiter.Get(id)
+		}
+		limiter.Get(ids[0])
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(0, len(counts))
+
+		limiter.Get(ids[3])
+		limiter.Get(ids[4])
+		limiter.Get(ids[3])
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(1, len(counts))
+		assert.Equal(4, <-counts)
+
+		// still over the threshold, it is not re-armed
+		limiter.Remove(ids[4])
+		limiter.Get(ids[4])
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(0, len(counts))
+
+		// re-armed at the threshold
+		limiter.Remove(ids[4])
+		limiter.Remove(ids[3])
+		limiter.Get(ids[3])
+		limiter.Get(ids[4])
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(1, len(counts))
+		assert.Equal(4, <-counts)
+	})
+
+	t.Run("limiter with KeyCountAlertThreshold and cleanup should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		counts := make(chan int, 10)
+		limiter := New(Options{
+			KeyCountAlertThreshold:   1,
+			OnHighWaterMark:          func(count int) { counts <- count },
+			DisableBackgroundCleanup: true,
+		})
+		backend := limiter.abstractLimiter.(*memoryLimiter)
+
+		limiter.Get(genID(), 1, 10)
+		limiter.Get(genID(), 1, 10)
+		assert.Equal(2, <-counts)
+
+		time.Sleep(30 * time.Millisecond)
+		backend.clean()
+		assert.Equal(0, len(backend.store))
+		limiter.Get(genID(), 1, 10)
+		limiter.Get(genID(), 1, 10)
+		assert.Equal(2, <-counts)
+	})
+}
+
+func TestMemoryErrorContract(t *testing.T) {
+	t.Run("limiter.Get over limit should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, algorithm := range []Algorithm{FixedWindow, SlidingWindow, Credits} {
+			limiter := New(Options{Algorithm: algorithm, Max: 2})
+			id := genID()
+			for i := 1; i >= -1; i-- {
+				res, err := limiter.Get(id)
+				assert.Nil(err)
+				assert.Equal(i, res.Remaining)
+			}
+			res, err := limiter.Get(id)
+			assert.Nil(err)
+			assert.Equal(-1, res.Remaining)
+			assert.True(res.HardExceeded)
+			assert.Equal(2, res.Total)
+		}
+	})
+
+	t.Run("limiter.Get over the last tier should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{1, 20, 1, 20}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				res, err := limiter.Get(id, policy...)
+				assert.Nil(err)
+				assert.Equal(1, res.Total)
+			}
+			time.Sleep(25 * time.Millisecond)
+		}
+
+		assert.Nil(limiter.Block(id, time.Minute))
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.True(res.HardExceeded)
+	})
+
+	t.Run("limiter.Get with error should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		res, err := limiter.Get(genID(), 1)
+		assert.NotNil(err)
+		assert.Equal(Result{}, res)
+		res, err = limiter.Get(genID(), 1, -1)
+		assert.NotNil(err)
+		assert.Equal(Result{}, res)
+	})
+}
+
+func TestMemoryOnSweep(t *testing.T) {
+	t.Run("limiter with OnSweep should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var sweeps []SweepStats
+		limiter := New(Options{
+			OnSweep:                  func(stats SweepStats) { sweeps = append(sweeps, stats) },
+			DisableBackgroundCleanup: true,
+		})
+		backend := limiter.abstractLimiter.(*memoryLimiter)
+		for i := 0; i < 5; i++ {
+			limiter.Get(genID(), 1, 10)
+		}
+		// expired after double the duration
+		time.Sleep(30 * time.Millisecond)
+		backend.clean()
+		assert.Equal(1, len(sweeps))
+		assert.Equal(5, sweeps[0].Examined)
+		assert.Equal(5, sweeps[0].Evicted)
+		assert.True(sweeps[0].Duration > 0)
+		assert.True(sweeps[0].Duration < time.Second)
+
+		// a live record is examined by every sample
+		for i := 0; i < 3; i++ {
+			limiter.Get(genID())
+		}
+		backend.clean()
+		assert.Equal(2, len(sweeps))
+		assert.Equal(24, sweeps[1].Examined)
+		assert.Equal(0, sweeps[1].Evicted)
+	})
+
+	t.Run("limiter with OnSweep and sliding window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var sweeps []SweepStats
+		for _, algorithm := range []Algorithm{SlidingWindow, Credits} {
+			limiter := New(Options{
+				Algorithm:                algorithm,
+				OnSweep:                  func(stats SweepStats) { sweeps = append(sweeps, stats) },
+				DisableBackgroundCleanup: true,
+			})
+			for i := 0; i < 3; i++ {
+				limiter.Get(genID(), 1, 10)
+			}
+			for i := 0; i < 2; i++ {
+				limiter.Get(genID())
+			}
+			time.Sleep(20 * time.Millisecond)
+			switch backend := limiter.abstractLimiter.(type) {
+			case *slidingMemoryLimiter:
+				backend.clean()
+			case *creditsMemoryLimiter:
+				backend.clean()
+			}
+		}
+		assert.Equal(2, len(sweeps))
+		for _, stats := range sweeps {
+			assert.Equal(5, stats.Examined)
+			assert.Equal(3, stats.Evicted)
+		}
+	})
+}
+
+func TestMemoryMaxActiveKeys(t *testing.T) {
+	t.Run("limiter with MaxActiveKeys should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{MaxActiveKeys: 2, DisableBackgroundCleanup: true})
+		backend := limiter.abstractLimiter.(*memoryLimiter)
+		id1, id2, id3 := genID(), genID(), genID()
+
+		limiter.Get(id1)
+		limiter.Get(id2, 1, 10)
+		res, err := limiter.Get(id3)
+		assert.Equal(ErrTooManyKeys, err)
+		assert.Equal(Result{}, res)
+		_, _, err = limiter.GetIfNotEscalated(id3)
+		assert.Equal(ErrTooManyKeys, err)
+
+		// existing ids are served
+		res, err = limiter.Get(id1)
+		assert.Nil(err)
+		assert.Equal(98, res.Remaining)
+		res, err = limiter.Get(id2, 1, 10)
+		assert.Nil(err)
+		assert.Equal(-1, res.Remaining)
+
+		assert.Nil(limiter.Remove(id1))
+		res, err = limiter.Get(id3)
+		assert.Nil(err)
+		assert.Equal(99, res.Remaining)
+
+		// an expired record counts until the cleanup
+		time.Sleep(30 * time.Millisecond)
+		_, err = limiter.Get(id1)
+		assert.Equal(ErrTooManyKeys, err)
+		backend.clean()
+		_, err = limiter.Get(id1)
+		assert.Nil(err)
+	})
+}
+
+func TestMemoryTopTierBlock(t *testing.T) {
+	t.Run("limiter with TopTierBlockCount should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{TopTierBlockCount: 2, TopTierBlockPenalty: 100 * time.Millisecond})
+		id := genID()
+		policy := []int{2, 30, 1, 30}
+
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+		res, _ := limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+
+		// the first used-up window of the top tier
+		time.Sleep(35 * time.Millisecond)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(1, res.Total)
+		assert.Equal(0, res.Remaining)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(30*time.Millisecond, res.Duration)
+
+		// the second one, blocked
+		time.Sleep(35 * time.Millisecond)
+		limiter.Get(id, policy...)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(100*time.Millisecond, res.Duration)
+		assert.True(res.Reset.After(time.Now().Add(90 * time.Millisecond)))
+		assert.Equal(1, res.Used)
+
+		time.Sleep(50 * time.Millisecond)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+
+		// unblocked after the penalty, and the status has expired
+		time.Sleep(60 * time.Millisecond)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+	})
+
+	t.Run("limiter with TopTierBlockCount and default penalty should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{TopTierBlockCount: 1, Duration: time.Second})
+		id := genID()
+		policy := []int{1, 1000}
+		limiter.Get(id, policy...)
+		res, _ := limiter.Get(id, policy...)
+		// no multi-policy, no escalation
+		assert.Equal(time.Second, res.Duration)
+		assert.Equal(time.Second, limiter.abstractLimiter.(*memoryLimiter).topBlockPenalty)
+	})
+}
+
+func TestMemoryConcurrentCreate(t *testing.T) {
+	t.Run("concurrent Gets of a new id should not lose updates", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, max := range []int{1000, 100} {
+			limiter := New(Options{Max: max, Duration: time.Minute})
+			id := genID()
+			var wg sync.WaitGroup
+			var lock sync.Mutex
+			allowed := 0
+			for i := 0; i < 200; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 3; j++ {
+						res, err := limiter.Get(id)
+						assert.Nil(err)
+						if res.Remaining >= 0 {
+							lock.Lock()
+							allowed++
+							lock.Unlock()
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			res, err := limiter.Peek(id)
+			assert.Nil(err)
+			if max > 600 {
+				assert.Equal(600, allowed)
+				assert.Equal(max-allowed, res.Remaining)
+			} else {
+				assert.Equal(max, allowed)
+				assert.Equal(-1, res.Remaining)
+			}
+		}
+	})
+}
+
+func TestMemoryResultAllowed(t *testing.T) {
+	t.Run("Result.Allowed should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 1})
+		id := genID()
+		res, _ := limiter.Get(id)
+		assert.Equal(0, res.Remaining)
+		assert.True(res.Allowed())
+		res, _ = limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+		assert.False(res.Allowed())
+	})
+}
+
+func TestMemoryEscalationCooldown(t *testing.T) {
+	// exhaust uses up a window of id and returns its total.
+	exhaust := func(limiter *Limiter, id string) int {
+		policy := []int{3, 40, 2, 40, 1, 40}
+		res, _ := limiter.Get(id, policy...)
+		for res.Remaining >= 0 {
+			res, _ = limiter.Get(id, policy...)
+		}
+		time.Sleep(45 * time.Millisecond)
+		return res.Total
+	}
+
+	t.Run("limiter without EscalationCooldown should escalate every window", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		assert.Equal(3, exhaust(limiter, id))
+		assert.Equal(2, exhaust(limiter, id))
+		assert.Equal(1, exhaust(limiter, id))
+	})
+
+	t.Run("limiter with EscalationCooldown should escalate once per cooldown", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{EscalationCooldown: 300 * time.Millisecond})
+		id := genID()
+		start := time.Now()
+		assert.Equal(3, exhaust(limiter, id))
+		for time.Since(start) < 240*time.Millisecond {
+			assert.Equal(2, exhaust(limiter, id))
+		}
+		for time.Since(start) < 360*time.Millisecond {
+			exhaust(limiter, id)
+		}
+		assert.Equal(1, exhaust(limiter, id))
+
+		stats, _, _ := limiter.KeyStats(id)
+		assert.Equal(2, stats.Escalations)
+	})
+
+	t.Run("limiter with EscalationCooldown should keep the cooldown after the status is swept", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{EscalationCooldown: 400 * time.Millisecond, DisableBackgroundCleanup: true})
+		m := limiter.abstractLimiter.(*memoryLimiter)
+		id := genID()
+		assert.Equal(3, exhaust(limiter, id))
+		assert.Equal(2, exhaust(limiter, id))
+
+		// the status expires double the duration after the last used-up window
+		time.Sleep(100 * time.Millisecond)
+		m.clean()
+		_, ok := m.status["{LIMIT:"+id+"}:S"]
+		assert.False(ok)
+
+		// the id starts at the first tier again, and it can't escalate in the cooldown
+		assert.Equal(3, exhaust(limiter, id))
+		assert.Equal(3, exhaust(limiter, id))
+		_, ok = m.status["{LIMIT:"+id+"}:S"]
+		assert.False(ok)
+
+		assert.Nil(limiter.Remove(id))
+		assert.Equal(3, exhaust(limiter, id))
+		assert.Equal(2, exhaust(limiter, id))
+	})
+}
+
+func TestMemoryStateTTL(t *testing.T) {
+	policy := []int{2, 20, 1, 20}
+	// escalate uses up a window of id, so it escalates to the second tier.
+	escalate := func(limiter *Limiter, id string) {
+		for i := 0; i < 3; i++ {
+			limiter.Get(id, policy...)
+		}
+	}
+
+	t.Run("limiter without StateTTL should forget the tier after a gap", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		escalate(limiter, id)
+		time.Sleep(100 * time.Millisecond)
+		res, _ := limiter.Get(id, policy...)
+		assert.Equal(2, res.Total)
+	})
+
+	t.Run("limiter with StateTTL should keep the tier for StateTTL", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{StateTTL: 300 * time.Millisecond})
+		id := genID()
+		escalate(limiter, id)
+		time.Sleep(100 * time.Millisecond)
+		res, _ := limiter.Get(id, policy...)
+		assert.Equal(1, res.Total)
+
+		// a Get keeps the state for StateTTL again
+		time.Sleep(200 * time.Millisecond)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(1, res.Total)
+
+		time.Sleep(400 * time.Millisecond)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(2, res.Total)
+	})
+
+	t.Run("limiter with StateTTL should keep the idle record for StateTTL", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{StateTTL: time.Minute, DisableBackgroundCleanup: true})
+		m := limiter.abstractLimiter.(*memoryLimiter)
+		id := genID()
+		limiter.Get(id, 1, 10)
+		time.Sleep(30 * time.Millisecond)
+		m.clean()
+		_, ok := m.store["LIMIT:"+id]
+		assert.True(ok)
+		res, _ := limiter.Get(id, 1, 10)
+		assert.False(res.FirstWindow)
+	})
+}
+
+func TestMemoryPolicyChange(t *testing.T) {
+	t.Run("limiter.Get with a new policy in the live window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+
+		res, err := limiter.Get(id, 3, 100)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(2, res.Remaining)
+
+		// the live window keeps its total and duration
+		res, err = limiter.Get(id, 5, 200)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(1, res.Remaining)
+		assert.Equal(time.Millisecond*100, res.Duration)
+
+		// the new policy takes effect from the next window
+		time.Sleep(res.Duration + time.Millisecond)
+		res, err = limiter.Get(id, 5, 200)
+		assert.Nil(err)
+		assert.Equal(5, res.Total)
+		assert.Equal(4, res.Remaining)
+		assert.Equal(time.Millisecond*200, res.Duration)
+	})
+
+	t.Run("limiter.Get with a new multi-policy in the live window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+
+		res, _ := limiter.Get(id, 1, 150)
+		assert.Equal(1, res.Total)
+		assert.Equal(0, res.Remaining)
+
+		// escalation status lasts for double the live window duration
+		res, _ = limiter.Get(id, 1, 20, 2, 50)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(time.Millisecond*150, res.Duration)
+
+		time.Sleep(res.Duration + time.Millisecond)
+		res, _ = limiter.Get(id, 1, 20, 2, 50)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+		assert.Equal(time.Millisecond*50, res.Duration)
+	})
+
+	t.Run("limiter.Get with fewer tiers than the escalated tier should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{1, 50, 1, 50, 1, 50, 4, 50}
+
+		for i := 0; i < 3; i++ {
+			limiter.Get(id, policy...)
+			res, _ := limiter.Get(id, policy...)
+			assert.Equal(-1, res.Remaining)
+			time.Sleep(res.Duration + time.Millisecond)
+		}
+
+		// the key is at the fourth tier, but the new policy has two tiers only
+		res, _ := limiter.Get(id, 1, 50, 2, 50)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+
+		// a single policy has no tiers
+		time.Sleep(res.Duration + time.Millisecond)
+		res, _ = limiter.Get(id, 6, 50)
+		assert.Equal(6, res.Total)
+		assert.Equal(5, res.Remaining)
+	})
+}
+
 func genID() string {
 	buf := make([]byte, 12)
 	_, err := rand.Read(buf)
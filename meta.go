@@ -0,0 +1,81 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxMetaSize is the max size of the meta for an id.
+const MaxMetaSize = 1024
+
+// SetMeta stores a small meta (at most MaxMetaSize bytes) with the limit record of id,
+// it will be returned by Get in Result.Meta.
+// The meta survives window resets, and it is removed with the record by Remove,
+// or when the record expires (double the duration after the last window started).
+// The record must exist, call Get first. A nil meta clears it.
+// It is supported by fixed window limiters only.
+func (l *Limiter) SetMeta(id string, meta []byte) error {
+	if len(meta) > MaxMetaSize {
+		return fmt.Errorf("ratelimiter: meta must be at most %d bytes", MaxMetaSize)
+	}
+	m, ok := l.abstractLimiter.(metaSetter)
+	if !ok {
+		return errors.New("ratelimiter: meta is only supported by fixed window limiter")
+	}
+	return m.setMeta(l.prefix+id, meta)
+}
+
+type metaSetter interface {
+	setMeta(key string, meta []byte) error
+}
+
+var errNoRecord = errors.New("ratelimiter: no limit record for id")
+
+// metaSetter interface
+func (m *memoryLimiter) setMeta(key string, meta []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.store[key]
+	if !ok {
+		return errNoRecord
+	}
+	if meta != nil {
+		meta = append([]byte{}, meta...)
+	}
+	item.meta = meta
+	return nil
+}
+
+// metaSetter interface
+func (r *redisLimiter) setMeta(key string, meta []byte) error {
+	keys := []string{key, fmt.Sprintf("{%s}:M", key)}
+	var args []interface{}
+	if meta != nil {
+		args = append(args, string(meta))
+	}
+	res, err := evalScript(r.rc, r.metaSha1, metaLua, keys, args...)
+	if err != nil {
+		return err
+	}
+	if n, ok := res.(int64); !ok || n != 1 {
+		return errNoRecord
+	}
+	return nil
+}
+
+const metaLua string = `
+-- KEYS[1] target hash key
+-- KEYS[2] target meta key
+-- ARGV[1] meta, clear the meta if omit
+
+local duration = tonumber(redis.call('hget', KEYS[1], 'dn'))
+if not duration then
+  return 0
+end
+if ARGV[1] then
+  redis.call('set', KEYS[2], ARGV[1], 'px', duration * 2)
+else
+  redis.call('del', KEYS[2])
+end
+return 1
+`
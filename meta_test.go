@@ -0,0 +1,76 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMeta(t *testing.T) {
+	t.Run("limiter.SetMeta should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{2, 100}
+
+		assert.Equal("ratelimiter: no limit record for id", limiter.SetMeta(id, []byte("vip")).Error())
+
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Nil(res.Meta)
+
+		assert.Nil(limiter.SetMeta(id, []byte("vip")))
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal([]byte("vip"), res.Meta)
+
+		// the meta of a result is a copy
+		res.Meta[0] = 'V'
+		res, _ = limiter.Peek(id)
+		assert.Equal([]byte("vip"), res.Meta)
+
+		// meta survives window resets
+		time.Sleep(res.Duration + time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(1, res.Remaining)
+		assert.Equal([]byte("vip"), res.Meta)
+
+		assert.Nil(limiter.SetMeta(id, nil))
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(res.Meta)
+
+		// meta is removed with the record
+		assert.Nil(limiter.SetMeta(id, []byte("blocked")))
+		assert.Nil(limiter.Remove(id))
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(1, res.Remaining)
+		assert.Nil(res.Meta)
+	})
+
+	t.Run("limiter.SetMeta with invalid meta should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		limiter.Get(id)
+
+		err := limiter.SetMeta(id, bytes.Repeat([]byte("x"), MaxMetaSize+1))
+		assert.Equal("ratelimiter: meta must be at most 1024 bytes", err.Error())
+		assert.Nil(limiter.SetMeta(id, bytes.Repeat([]byte("x"), MaxMetaSize)))
+
+		// meta is copied
+		meta := []byte("abc")
+		assert.Nil(limiter.SetMeta(id, meta))
+		meta[0] = 'x'
+		res, _ := limiter.Get(id)
+		assert.Equal([]byte("abc"), res.Meta)
+
+		limiter = New(Options{Algorithm: SlidingWindow})
+		limiter.Get(id)
+		err = limiter.SetMeta(id, meta)
+		assert.Equal("ratelimiter: meta is only supported by fixed window limiter", err.Error())
+	})
+}
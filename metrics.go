@@ -0,0 +1,113 @@
+package ratelimiter
+
+import (
+	"expvar"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics is the counters of a Limiter since it was created.
+type Metrics struct {
+	Allowed int64 `json:"allowed"` // The count of allowed requests by Get
+	Denied  int64 `json:"denied"`  // The count of denied requests by Get
+	// Keys is the count of ids with a limit record, it is -1 for a redis limiter.
+	Keys int `json:"keys"`
+}
+
+// counters are updated atomically, they must be 64-bit aligned, so they are allocated alone.
+type counters struct {
+	allowed int64
+	denied  int64
+}
+
+type keyCounter interface {
+	keyCount() int
+}
+
+func (l *Limiter) count(result Result) {
+	if result.HardExceeded {
+		atomic.AddInt64(&l.counters.denied, 1)
+	} else {
+		atomic.AddInt64(&l.counters.allowed, 1)
+	}
+}
+
+// Metrics returns the counters of the limiter.
+func (l *Limiter) Metrics() Metrics {
+	m := Metrics{
+		Allowed: atomic.LoadInt64(&l.counters.allowed),
+		Denied:  atomic.LoadInt64(&l.counters.denied),
+		Keys:    -1,
+	}
+	if c, ok := l.abstractLimiter.(keyCounter); ok {
+		m.Keys = c.keyCount()
+	}
+	return m
+}
+
+// ResetMetrics resets the counters of the limiter to zero and returns their prior values,
+// total is allowed plus denied, so a periodic reporter gets the counts of each interval.
+// Each counter is swapped atomically, so a concurrent Get is counted in exactly one interval,
+// but the counters are not swapped at once, so the interval of a Get between the two swaps
+// depends on whether it is allowed or denied.
+func (l *Limiter) ResetMetrics() (total, allowed, denied uint64) {
+	allowed = uint64(atomic.SwapInt64(&l.counters.allowed, 0))
+	denied = uint64(atomic.SwapInt64(&l.counters.denied, 0))
+	return allowed + denied, allowed, denied
+}
+
+// expvars are the limiters published by Options.ExpvarName.
+var expvars = struct {
+	sync.Mutex
+	limiters map[string]*Limiter
+}{limiters: make(map[string]*Limiter)}
+
+// publishExpvar publishes the Metrics of l as an expvar. A name is published once,
+// a later limiter with the same name replaces the former one in the var.
+func publishExpvar(name string, l *Limiter) {
+	expvars.Lock()
+	defer expvars.Unlock()
+	if _, ok := expvars.limiters[name]; !ok {
+		if expvar.Get(name) != nil {
+			log.Printf("ratelimiter: expvar %q is published by others", name)
+			return
+		}
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			expvars.Lock()
+			limiter := expvars.limiters[name]
+			expvars.Unlock()
+			return limiter.Metrics()
+		}))
+	}
+	expvars.limiters[name] = l
+}
+
+// keyCounter interface
+func (m *memoryLimiter) keyCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.store)
+}
+
+// keyCounter interface
+func (m *slidingMemoryLimiter) keyCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.store)
+}
+
+// keyCounter interface
+func (m *creditsMemoryLimiter) keyCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.store)
+}
+
+// SweepStats is the statistics of one cleanup sweep of a memory limiter, see Options.OnSweep.
+type SweepStats struct {
+	Duration time.Duration // The time the sweep took
+	Examined int           // The count of records examined
+	Evicted  int           // The count of expired records removed
+}
@@ -0,0 +1,109 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("limiter.Metrics should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 2})
+		id := genID()
+		for i := 0; i < 3; i++ {
+			limiter.Get(id)
+		}
+		limiter.Get(genID())
+		assert.Equal(Metrics{Allowed: 3, Denied: 1, Keys: 2}, limiter.Metrics())
+
+		limiter = New(Options{Algorithm: SlidingWindow})
+		limiter.Get(id)
+		assert.Equal(Metrics{Allowed: 1, Keys: 1}, limiter.Metrics())
+
+		limiter = New(Options{Client: &mockRedisClient{}})
+		limiter.Get(id)
+		assert.Equal(Metrics{Allowed: 1, Keys: -1}, limiter.Metrics())
+	})
+
+	t.Run("limiter.ResetMetrics should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 2})
+		id := genID()
+		for i := 0; i < 3; i++ {
+			limiter.Get(id)
+		}
+		total, allowed, denied := limiter.ResetMetrics()
+		assert.Equal([]uint64{3, 2, 1}, []uint64{total, allowed, denied})
+		assert.Equal(Metrics{Keys: 1}, limiter.Metrics())
+		total, _, _ = limiter.ResetMetrics()
+		assert.Equal(uint64(0), total)
+	})
+
+	t.Run("limiter.ResetMetrics should not lose concurrent counts", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 500})
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					limiter.Get(genID()[:2])
+				}
+			}()
+		}
+		done := make(chan struct{})
+		var sum, allowedSum, deniedSum uint64
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				total, allowed, denied := limiter.ResetMetrics()
+				sum += total
+				allowedSum += allowed
+				deniedSum += denied
+			}
+		}()
+		wg.Wait()
+		<-done
+		total, allowed, denied := limiter.ResetMetrics()
+		assert.Equal(uint64(2000), sum+total)
+		assert.Equal(sum+total, allowedSum+allowed+deniedSum+denied)
+	})
+
+	t.Run("limiter with ExpvarName should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		name := "ratelimiter-" + genID()
+		limiter := New(Options{Max: 1, ExpvarName: name})
+		v := expvar.Get(name)
+		assert.NotNil(v)
+
+		var m map[string]int
+		assert.Nil(json.Unmarshal([]byte(v.String()), &m))
+		assert.Equal(map[string]int{"allowed": 0, "denied": 0, "keys": 0}, m)
+
+		id := genID()
+		limiter.Get(id)
+		limiter.Get(id)
+		assert.Nil(json.Unmarshal([]byte(v.String()), &m))
+		assert.Equal(map[string]int{"allowed": 1, "denied": 1, "keys": 1}, m)
+
+		// the same name doesn't panic, the last limiter is published
+		limiter = New(Options{ExpvarName: name})
+		assert.Nil(json.Unmarshal([]byte(expvar.Get(name).String()), &m))
+		assert.Equal(map[string]int{"allowed": 0, "denied": 0, "keys": 0}, m)
+
+		// a name published by others is skipped
+		other := "other-" + genID()
+		expvar.NewInt(other)
+		New(Options{ExpvarName: other})
+		assert.Equal("0", expvar.Get(other).String())
+	})
+}
@@ -0,0 +1,32 @@
+package ratelimiter
+
+// OverLimitMode is what Result.Remaining reports for a denied request, see Options.OverLimitRemaining.
+// It changes the report only, a request is denied when its window is used up in every mode.
+type OverLimitMode int
+
+const (
+	// OverLimitNegativeOne reports -1, it is the default.
+	OverLimitNegativeOne OverLimitMode = iota
+	// OverLimitZero reports 0, so a client can't tell a denied request from the last allowed one
+	// by Remaining, and Result.HardExceeded or Result.Allowed must be used.
+	OverLimitZero
+	// OverLimitTrueOverflow reports the negative count of the denied requests in the window,
+	// so the first denied request is -1, the second is -2, and so on. A denial that is not counted,
+	// by GetIfNotEscalated of an escalated id or by Peek, reports the count of the live window,
+	// or -1 if there is none (such as a blocked id). The sliding window and credits limiters
+	// don't count the denied requests, so they always report -1.
+	OverLimitTrueOverflow
+)
+
+// remaining returns Result.Remaining of a denied request with overflow denied requests in the window.
+func (m OverLimitMode) remaining(overflow int) int {
+	switch m {
+	case OverLimitZero:
+		return 0
+	case OverLimitTrueOverflow:
+		if overflow > 0 {
+			return -overflow
+		}
+	}
+	return -1
+}
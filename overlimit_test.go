@@ -0,0 +1,67 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryOverLimitRemaining(t *testing.T) {
+	// over gets id 4 times with Max 2, and returns the Remaining of the denied requests.
+	over := func(limiter *Limiter, id string) []int {
+		var res []int
+		for i := 0; i < 4; i++ {
+			result, err := limiter.Get(id)
+			if err == nil && !result.Allowed() {
+				res = append(res, result.Remaining)
+			}
+		}
+		return res
+	}
+
+	t.Run("limiter with OverLimitRemaining should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for mode, expected := range map[OverLimitMode][]int{
+			OverLimitNegativeOne:  {-1, -1},
+			OverLimitZero:         {0, 0},
+			OverLimitTrueOverflow: {-1, -2},
+		} {
+			limiter := New(Options{Max: 2, OverLimitRemaining: mode})
+			id := genID()
+			assert.Equal(expected, over(limiter, id))
+
+			res, err := limiter.Peek(id)
+			assert.Nil(err)
+			assert.True(res.HardExceeded)
+			assert.Equal(expected[1], res.Remaining)
+			assert.Equal(Metrics{Allowed: 2, Denied: 2, Keys: 1}, limiter.Metrics())
+		}
+	})
+
+	t.Run("limiter with OverLimitTrueOverflow should reset the overflow with the window", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 2, Duration: 20 * time.Millisecond, OverLimitRemaining: OverLimitTrueOverflow})
+		id := genID()
+		assert.Equal([]int{-1, -2}, over(limiter, id))
+		time.Sleep(25 * time.Millisecond)
+		assert.Equal([]int{-1, -2}, over(limiter, id))
+
+		assert.Nil(limiter.Block(id, time.Minute))
+		res, _ := limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+		res, _ = limiter.Get(id)
+		assert.Equal(-2, res.Remaining)
+	})
+
+	t.Run("sliding window and credits limiters with OverLimitTrueOverflow should report -1", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, algorithm := range []Algorithm{SlidingWindow, Credits} {
+			limiter := New(Options{Max: 2, Algorithm: algorithm, OverLimitRemaining: OverLimitTrueOverflow})
+			assert.Equal([]int{-1, -1}, over(limiter, genID()))
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package ratelimiter
+
+import (
+	"errors"
+	"time"
+)
+
+type peeker interface {
+	// peekLimit returns the result slice of the live window of key without counting,
+	// or nil if there is none and create is false.
+	peekLimit(key string, create bool, policy ...int) ([]interface{}, error)
+}
+
+// Peek returns the Result of the live window of id without counting a request.
+// It is read-only: for an id without a live window, it returns a zero Result and creates nothing.
+// It is supported by fixed window limiters only.
+func (l *Limiter) Peek(id string, policy ...int) (Result, error) {
+	return l.peek(id, false, policy...)
+}
+
+// PeekOrCreate is Peek, but for an id without a live window, it creates a window of the policy
+// with the full quota (Remaining equals Total) and returns it, as if the id had been seen.
+func (l *Limiter) PeekOrCreate(id string, policy ...int) (Result, error) {
+	return l.peek(id, true, policy...)
+}
+
+func (l *Limiter) peek(id string, create bool, policy ...int) (Result, error) {
+	p, ok := l.abstractLimiter.(peeker)
+	if !ok {
+		return Result{}, errors.New("ratelimiter: peek is only supported by fixed window limiter")
+	}
+	if l.serialize {
+		l.serial.Lock()
+		defer l.serial.Unlock()
+	}
+	policy, err := l.policy(policy...)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := p.peekLimit(l.prefix+id, create, policy...)
+	if err != nil || res == nil {
+		return Result{}, err
+	}
+	return l.result(res), nil
+}
+
+// peeker interface
+func (m *memoryLimiter) peekLimit(key string, create bool, policy ...int) ([]interface{}, error) {
+	args, err := m.limitArgs(policy...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.store[key]
+	if ok && item.expire.After(now) {
+		res := item.result()
+		if item.remaining < 0 {
+			res[0] = -1
+		}
+		return res, nil
+	}
+	if !create {
+		return nil, nil
+	}
+	if err := m.admit(key); err != nil {
+		return nil, err
+	}
+
+	index := m.policyIndex("{"+key+"}:S", len(args)/2)
+	total := args[(index*2)-2]
+	duration := time.Duration(args[(index*2)-1]) * time.Millisecond
+	if ok {
+		m.rollover(item, total, duration, now)
+		return item.result(), nil
+	}
+	item = &limiterCacheItem{
+		total:     total,
+		remaining: total,
+		duration:  duration,
+		expire:    now.Add(duration),
+		firstSeen: now,
+	}
+	m.store[key] = item
+	m.checkHighWaterMark()
+	return item.result(), nil
+}
+
+// peeker interface
+func (r *redisLimiter) peekLimit(key string, create bool, policy ...int) ([]interface{}, error) {
+	keys, args, err := r.limitArgs(key, policy...)
+	if err != nil {
+		return nil, err
+	}
+	flag := "0"
+	if create {
+		flag = "1"
+	}
+	res, err := evalScript(r.rc, r.peekSha1, peekLua, keys, append([]interface{}{flag}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := res.([]interface{})
+	if !ok {
+		return nil, errors.New("Invalid result")
+	}
+	if len(arr) < 4 {
+		return nil, nil
+	}
+	return arr, nil
+}
+
+const peekLua string = `
+-- KEYS[1] target hash key
+-- KEYS[2] target status hash key
+-- KEYS[3] target meta key
+-- KEYS[4] target seen key
+-- KEYS[5] target top tier hits key
+-- KEYS[6] target stored policy hash key
+-- KEYS[7] target escalation cooldown key
+-- ARGV[1] "1" to create a full window if there is none, ARGV[n >= 2] the same as the limit script
+
+local res = {}
+local limit = redis.call('hmget', KEYS[1], 'ct', 'lt', 'dn', 'rt', 'fw', 'ov', 'al')
+
+if limit[1] then
+
+  res[1] = tonumber(limit[1])
+  res[2] = tonumber(limit[2])
+  res[3] = tonumber(limit[3])
+  res[4] = tonumber(limit[4])
+  res[6] = tonumber(limit[5]) or 0
+  res[7] = 0
+  res[8] = tonumber(limit[6]) or 0
+  res[9] = tonumber(limit[7]) or 0
+  if res[1] < -1 then
+    res[1] = -1
+  end
+
+elseif ARGV[1] == '1' then
+
+  local policy = {}
+  for i = 3, #ARGV - 4 do
+    policy[#policy + 1] = ARGV[i]
+  end
+  if ARGV[#ARGV] == '1' then
+    local stored = redis.call('hmget', KEYS[6], 'mx', 'dn')
+    if stored[1] then
+      policy = {stored[1], stored[2]}
+    end
+  end
+  local policyCount = #policy / 2
+  local index = 1
+  if policyCount > 1 then
+    index = tonumber(redis.call('get', KEYS[2])) or 1
+    if index > policyCount then
+      index = policyCount
+    end
+  end
+
+  local total = tonumber(policy[index * 2 - 1])
+  res[1] = total
+  res[2] = total
+  res[3] = tonumber(policy[index * 2])
+  res[4] = tonumber(ARGV[2]) + res[3]
+  res[6] = 1 - redis.call('exists', KEYS[4])
+  res[7] = 0
+  res[8] = 0
+  res[9] = 0
+
+  redis.call('hmset', KEYS[1], 'ct', res[1], 'lt', res[2], 'dn', res[3], 'rt', res[4], 'fw', res[6], 'al', 0)
+  redis.call('set', KEYS[4], 1, 'px', res[3] * 2)
+  redis.call('pexpire', KEYS[1], res[3])
+  if redis.call('exists', KEYS[3]) == 1 then
+    redis.call('pexpire', KEYS[3], res[3] * 2)
+  end
+
+else
+  return {}
+end
+
+res[5] = redis.call('get', KEYS[3])
+return res
+`
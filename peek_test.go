@@ -0,0 +1,93 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryPeek(t *testing.T) {
+	t.Run("limiter.Peek should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+
+		res, err := limiter.Peek(id)
+		assert.Nil(err)
+		assert.Equal(Result{}, res)
+		assert.Equal(0, limiter.Metrics().Keys)
+
+		limiter.Get(id, 2, 50)
+		for i := 0; i < 2; i++ {
+			res, err = limiter.Peek(id, 2, 50)
+			assert.Nil(err)
+			assert.Equal(2, res.Total)
+			assert.Equal(1, res.Remaining)
+			assert.Equal(1, res.Used)
+			assert.True(res.FirstWindow)
+		}
+		limiter.Get(id, 2, 50)
+		limiter.Get(id, 2, 50)
+		limiter.Get(id, 2, 50)
+		res, _ = limiter.Peek(id, 2, 50)
+		assert.Equal(-1, res.Remaining)
+		assert.True(res.HardExceeded)
+
+		// an expired window is not live
+		time.Sleep(60 * time.Millisecond)
+		res, _ = limiter.Peek(id, 2, 50)
+		assert.Equal(Result{}, res)
+		res, _ = limiter.Get(id, 2, 50)
+		assert.Equal(1, res.Remaining)
+		assert.Equal(Metrics{Allowed: 3, Denied: 2, Keys: 1}, limiter.Metrics())
+	})
+
+	t.Run("limiter.PeekOrCreate should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{2, 50, 5, 50}
+
+		res, err := limiter.PeekOrCreate(id, policy...)
+		assert.Nil(err)
+		assert.Equal(2, res.Total)
+		assert.Equal(2, res.Remaining)
+		assert.Equal(0, res.Used)
+		assert.True(res.FirstWindow)
+		assert.True(res.Reset.After(time.Now()))
+		assert.Equal(1, limiter.Metrics().Keys)
+
+		res, _ = limiter.PeekOrCreate(id, policy...)
+		assert.Equal(2, res.Remaining)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(1, res.Remaining)
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+
+		// a new window of the escalated tier
+		time.Sleep(60 * time.Millisecond)
+		res, _ = limiter.PeekOrCreate(id, policy...)
+		assert.Equal(5, res.Total)
+		assert.Equal(5, res.Remaining)
+		assert.False(res.FirstWindow)
+		res, _ = limiter.Get(id, policy...)
+		assert.Equal(4, res.Remaining)
+	})
+
+	t.Run("limiter.Peek with error should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		_, err := limiter.Peek(genID(), 1)
+		assert.Equal("ratelimiter: must be paired values", err.Error())
+		_, err = limiter.PeekOrCreate(genID(), 1, 0)
+		assert.Equal("ratelimiter: must be positive integer", err.Error())
+
+		limiter = New(Options{Algorithm: SlidingWindow})
+		_, err = limiter.Peek(genID())
+		assert.Equal("ratelimiter: peek is only supported by fixed window limiter", err.Error())
+	})
+}
@@ -0,0 +1,96 @@
+package ratelimiter
+
+import (
+	"errors"
+	"time"
+)
+
+// Policy is a limiter policy of paired values: max count, duration in milliseconds, max count, duration, ...
+// It can be passed to Get as policy...
+type Policy []int
+
+// MaxQPS returns the sustained requests per second that every tier of the policy allows,
+// that is max count / duration in seconds, for capacity planning.
+func (p Policy) MaxQPS() ([]float64, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	qps := make([]float64, len(p)/2)
+	for i := range qps {
+		max, duration := p[i*2], p[i*2+1]
+		qps[i] = float64(max) / (time.Duration(duration) * time.Millisecond).Seconds()
+	}
+	return qps, nil
+}
+
+// Validate returns the error that Get returns for the policy, if any: the values must be paired
+// and positive. An empty policy is valid, Get uses DefaultPolicy then. A limiter may reject more:
+// the sliding window and credits limiters take one tier only, and RejectDuplicateTiers rejects
+// consecutive identical tiers.
+func (p Policy) Validate() error {
+	if len(p)%2 == 1 {
+		return errors.New("ratelimiter: must be paired values")
+	}
+	for _, val := range p {
+		if val <= 0 {
+			return errors.New("ratelimiter: must be positive integer")
+		}
+	}
+	return nil
+}
+
+// ValidatePolicy checks a policy without Get, such as a policy from config at startup, see Policy.Validate.
+func ValidatePolicy(policy ...int) error {
+	return Policy(policy).Validate()
+}
+
+// DefaultPolicy returns the policy of Options.Max and Options.Duration,
+// it is used by Get without policy.
+func (l *Limiter) DefaultPolicy() Policy {
+	return Policy{l.max, int(l.duration / time.Millisecond)}
+}
+
+// DuplicateTierMode is how a Limiter handles the consecutive identical tiers of a policy,
+// such as 10, 1000, 10, 1000, which take an escalation step without changing anything.
+type DuplicateTierMode int
+
+const (
+	// KeepDuplicateTiers uses the policy as is, it is the default.
+	KeepDuplicateTiers DuplicateTierMode = iota
+	// CollapseDuplicateTiers collapses the consecutive identical tiers to one tier before counting,
+	// so 10, 1000, 10, 1000, 5, 1000 is the same as 10, 1000, 5, 1000.
+	CollapseDuplicateTiers
+	// RejectDuplicateTiers fails Get with an error for a policy with consecutive identical tiers.
+	RejectDuplicateTiers
+)
+
+// collapse returns the policy without consecutive identical tiers,
+// it returns p itself if there is none.
+func (p Policy) collapse() Policy {
+	var res Policy
+	for i := 2; i+1 < len(p); i += 2 {
+		if p[i] == p[i-2] && p[i+1] == p[i-1] {
+			if res == nil {
+				res = append(Policy{}, p[:i]...)
+			}
+		} else if res != nil {
+			res = append(res, p[i], p[i+1])
+		}
+	}
+	if res == nil {
+		return p
+	}
+	return res
+}
+
+// tiers applies mode to a paired policy.
+func (p Policy) tiers(mode DuplicateTierMode) (Policy, error) {
+	if mode == KeepDuplicateTiers {
+		return p, nil
+	}
+	res := p.collapse()
+	if mode == RejectDuplicateTiers && len(res) != len(p) {
+		return nil, errors.New("ratelimiter: duplicate policy tiers")
+	}
+	return res, nil
+}
@@ -0,0 +1,117 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Run("Policy.MaxQPS should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Max: 1000, Duration: time.Minute})
+		policy := limiter.DefaultPolicy()
+		assert.Equal(Policy{1000, 60000}, policy)
+		qps, err := policy.MaxQPS()
+		assert.Nil(err)
+		assert.Equal(1, len(qps))
+		assert.InDelta(16.67, qps[0], 0.01)
+
+		qps, err = Policy{100, 1000, 50, 1000, 10, 2000}.MaxQPS()
+		assert.Nil(err)
+		assert.Equal([]float64{100, 50, 5}, qps)
+
+		qps, err = Policy{}.MaxQPS()
+		assert.Nil(err)
+		assert.Equal(0, len(qps))
+	})
+
+	t.Run("Policy.MaxQPS with invalid policy should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := Policy{100, 1000, 50}.MaxQPS()
+		assert.Equal("ratelimiter: must be paired values", err.Error())
+		_, err = Policy{100, 0}.MaxQPS()
+		assert.Equal("ratelimiter: must be positive integer", err.Error())
+	})
+
+	t.Run("ValidatePolicy should be", func(t *testing.T) {
+		assert := assert.New(t)
+		limiter := New(Options{})
+
+		for _, policy := range [][]int{nil, {10, 1000}, {10, 1000, 5, 60000}} {
+			assert.Nil(ValidatePolicy(policy...))
+			assert.Nil(Policy(policy).Validate())
+			_, err := limiter.Get(genID(), policy...)
+			assert.Nil(err)
+		}
+		for _, policy := range [][]int{{10}, {10, 1000, 5}, {0, 1000}, {10, -1}, {10, 1000, 5, 0}} {
+			err := ValidatePolicy(policy...)
+			assert.NotNil(err)
+			_, getErr := limiter.Get(genID(), policy...)
+			assert.Equal(getErr, err)
+		}
+		assert.Equal("ratelimiter: must be paired values", ValidatePolicy(10, 1000, 5).Error())
+		assert.Equal("ratelimiter: must be positive integer", Policy{10, 0}.Validate().Error())
+	})
+
+	t.Run("limiter.Get with Policy should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		policy := Policy{3, 1000}
+		res, err := limiter.Get(genID(), policy...)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(2, res.Remaining)
+	})
+}
+
+func TestDuplicateTiers(t *testing.T) {
+	t.Run("Policy.collapse should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(Policy{10, 1000, 5, 1000}, Policy{10, 1000, 10, 1000, 5, 1000}.collapse())
+		assert.Equal(Policy{10, 1000, 5, 1000, 10, 1000}, Policy{10, 1000, 5, 1000, 5, 1000, 10, 1000, 10, 1000}.collapse())
+		assert.Equal(Policy{10, 1000}, Policy{10, 1000, 10, 1000}.collapse())
+		// only identical pairs are duplicate
+		assert.Equal(Policy{10, 1000, 10, 2000, 1000, 2000}, Policy{10, 1000, 10, 2000, 1000, 2000}.collapse())
+
+		policy := Policy{10, 1000, 10, 1000}
+		policy.collapse()
+		assert.Equal(Policy{10, 1000, 10, 1000}, policy)
+	})
+
+	t.Run("limiter with DuplicateTiers should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		policy := []int{1, 50, 1, 50, 3, 50}
+		for _, mode := range []DuplicateTierMode{KeepDuplicateTiers, CollapseDuplicateTiers} {
+			limiter := New(Options{DuplicateTiers: mode})
+			id := genID()
+			limiter.Get(id, policy...)
+			limiter.Get(id, policy...)
+			time.Sleep(60 * time.Millisecond)
+			res, err := limiter.Get(id, policy...)
+			assert.Nil(err)
+			if mode == KeepDuplicateTiers {
+				// escalated to the duplicate tier
+				assert.Equal(1, res.Total)
+			} else {
+				assert.Equal(3, res.Total)
+			}
+		}
+
+		limiter := New(Options{DuplicateTiers: RejectDuplicateTiers})
+		_, err := limiter.Get(genID(), policy...)
+		assert.Equal("ratelimiter: duplicate policy tiers", err.Error())
+		res, err := limiter.Get(genID(), 1, 50, 3, 50)
+		assert.Nil(err)
+		assert.Equal(1, res.Total)
+		res, err = limiter.Get(genID(), 1, 50)
+		assert.Nil(err)
+		assert.Equal(1, res.Total)
+	})
+}
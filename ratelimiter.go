@@ -1,10 +1,17 @@
 package ratelimiter
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -71,28 +78,245 @@ type RedisClient interface {
 // Limiter struct.
 type Limiter struct {
 	abstractLimiter
-	prefix string
+	prefix          string
+	max             int
+	duration        time.Duration
+	snapshotWriter  io.Writer
+	snapshotLock    sync.Mutex
+	breaker         *breaker
+	failOpen        bool
+	serialize       bool
+	serial          sync.Mutex
+	softRatio       float64
+	renameOverwrite bool
+	probeKeys       map[string]bool
+	adaptive        *adaptive
+	duplicateTiers  DuplicateTierMode
+	counters        *counters
+
+	distinctThreshold int
+	overLimit         OverLimitMode
+
+	// done is closed by Close, it stops the snapshot loop.
+	done            chan struct{}
+	closeOnce       sync.Once
+	snapshotStopped chan struct{}
 }
 
+// Algorithm is the counting algorithm used by a Limiter.
+type Algorithm int
+
+const (
+	// FixedWindow counts requests in fixed windows that reset after the duration.
+	// It is the default algorithm and supports multi-policy.
+	FixedWindow Algorithm = iota
+	// SlidingWindow counts requests in the exact duration before every request,
+	// so there is no double burst around the window boundary.
+	// It keeps one member (a timestamp) per in-window request for every key,
+	// so a key limited to max requests costs up to max members in memory or redis.
+	// It supports one policy pair only.
+	SlidingWindow
+	// Credits gives every id max credits, a request spends one credit and
+	// the credits are earned back over time (see Options.EarnBackInterval) up to max,
+	// there is no window reset. Reset is the time the next credit is earned back.
+	// It supports one policy pair only.
+	Credits
+)
+
 // Options for Limiter
 type Options struct {
-	Max      int           // The max count in duration for no policy, default is 100.
-	Duration time.Duration // Count duration for no policy, default is 1 Minute.
-	Prefix   string        // Redis key prefix, default is "LIMIT:".
-	Client   RedisClient   // Use a redis client for limiter, if omit, it will use a memory limiter.
+	Max       int           // The max count in duration for no policy, default is 100.
+	Duration  time.Duration // Count duration for no policy, default is 1 Minute.
+	Prefix    string        // Redis key prefix, default is "LIMIT:".
+	Client    RedisClient   // Use a redis client for limiter, if omit, it will use a memory limiter.
+	Algorithm Algorithm     // The counting algorithm, default is FixedWindow.
+
+	// SnapshotWriter receives the state of a memory limiter on every snapshot, see Limiter.Flush.
+	SnapshotWriter io.Writer
+	// SnapshotInterval is the interval of periodic snapshots to SnapshotWriter, if omit, snapshot only by Flush.
+	// It is ignored by the limiters without snapshots, they have no periodic snapshot.
+	SnapshotInterval time.Duration
+
+	// BreakerThreshold is the count of consecutive redis errors within BreakerWindow that opens
+	// the circuit breaker of a redis limiter, if omit, there is no circuit breaker.
+	// An open breaker fails requests without calling redis for BreakerCooldown,
+	// then lets one request through to test whether redis has recovered.
+	BreakerThreshold int
+	BreakerWindow    time.Duration // The window for consecutive errors, default is 10 Seconds.
+	BreakerCooldown  time.Duration // The time to keep the breaker open, default is 5 Seconds.
+	// BreakerFailOpen allows requests while the breaker is open with the Result of a fresh window,
+	// by default Get returns ErrCircuitOpen.
+	BreakerFailOpen bool
+
+	// LazyScriptLoad skips loading the lua scripts when the redis limiter is created,
+	// they are loaded by the first requests instead (the first EVALSHA fails with NOSCRIPT).
+	// By default New loads the scripts, so the first request runs EVALSHA directly,
+	// and New panics if redis is not reachable or refuses the scripts.
+	// The scripts are loaded once for a client, the later limiters of the client don't load them again.
+	LazyScriptLoad bool
+
+	// DebugRemainingJitter is for load tests only, never use it in production.
+	// A memory limiter starts every new id with a random remaining from
+	// total - 1 - DebugRemainingJitter to total - 1 (at least 0), so simulated ids
+	// don't use up their quotas at the same time. Window resets start with the full quota.
+	DebugRemainingJitter int
+	// Rand is the random source for DebugRemainingJitter, set it for deterministic tests.
+	// It must not be used by other goroutines.
+	Rand *rand.Rand
+
+	// SerializeAll is for debugging only, it is slow. All Get and Remove calls of the limiter
+	// run one by one under a single mutex, so a suspected race can be confirmed
+	// by checking whether it goes away when serialized.
+	SerializeAll bool
+
+	// SoftRatio sets a soft cap at SoftRatio * Total (0 < SoftRatio < 1) for every policy.
+	// Requests over the soft cap are still allowed, but flagged by Result.SoftExceeded,
+	// so clients can be warned before the hard cap (Total) denies them.
+	// There is one ratio for all the tiers of a policy, no soft cap per tier, and New panics
+	// if it is out of range. If omit, there is no soft cap.
+	SoftRatio float64
+
+	// EarnBackInterval is the time to earn back one credit with the Credits algorithm,
+	// default is the policy duration divided by its max count, so all credits are earned back in one duration.
+	EarnBackInterval time.Duration
+
+	// DisableBackgroundCleanup skips the goroutine that removes expired records of a memory limiter
+	// every second, for short-lived processes and tests. An expired record is still reset when
+	// its id is accessed again, but the records of ids never accessed again stay in memory
+	// until Remove, so don't use it with unbounded ids.
+	DisableBackgroundCleanup bool
+
+	// KeyCountAlertThreshold is the key count of a fixed window memory limiter that fires
+	// OnHighWaterMark, as an early warning of memory growth. The callback is called in a new
+	// goroutine with the key count, once when a new key makes the count exceed the threshold,
+	// and it is re-armed after the count drops to the threshold by Remove or the cleanup.
+	KeyCountAlertThreshold int
+	OnHighWaterMark        func(count int)
+
+	// AdaptiveLatencyTarget makes the limiter adaptive (AIMD) if set: Get without policy limits
+	// new windows to an effective max count, which is adjusted by Limiter.ReportLatency.
+	// Every reported latency over the target multiplies the effective max count by AdaptiveDecrease,
+	// and every other latency adds AdaptiveIncrease to it, from AdaptiveMin up to Max.
+	// As with a policy change, a live window keeps its total.
+	AdaptiveLatencyTarget time.Duration
+	AdaptiveDecrease      float64 // The multiplicative decrease (0 < AdaptiveDecrease < 1), default is 0.5.
+	AdaptiveIncrease      int     // The additive increase, default is 1.
+	AdaptiveMin           int     // The min effective max count, default is 1.
+
+	// DuplicateTiers is how Get handles the consecutive identical tiers of a policy,
+	// default is KeepDuplicateTiers.
+	DuplicateTiers DuplicateTierMode
+
+	// OnSweep is called with the statistics at the end of every cleanup sweep of a memory limiter,
+	// on the cleanup goroutine. The fixed window limiter examines a sample of its records per sweep,
+	// the sliding window and credits limiters examine all of them.
+	OnSweep func(stats SweepStats)
+
+	// MaxActiveKeys protects the working set of a fixed window memory limiter if set:
+	// when it has MaxActiveKeys records, Get of a new id fails with ErrTooManyKeys,
+	// and the ids with records are served as usual. A record counts until it is removed
+	// by Remove or the cleanup, so expired records count for up to a second.
+	MaxActiveKeys int
+
+	// TopTierBlockCount hard blocks an id with multi-policy for TopTierBlockPenalty (see Limiter.Block)
+	// if set, when the id has used up TopTierBlockCount windows of the last tier.
+	// The count of an id is reset when it is blocked, or when its policy status expires
+	// (double the duration after its last used-up window, see Get).
+	TopTierBlockCount   int
+	TopTierBlockPenalty time.Duration // The penalty of TopTierBlockCount, default is Options.Duration.
+
+	// EscalationCooldown paces the escalation of an id with multi-policy if set: the id advances
+	// to the next tier at most once per EscalationCooldown, whatever the duration of the policies.
+	// By default it advances once per used-up window, so with a window of a second it reaches
+	// the last tier in a few seconds. With a window shorter than the cooldown, a used-up window
+	// in the cooldown keeps the tier, and the id stays at the tier of the last step.
+	EscalationCooldown time.Duration
+
+	// StateTTL keeps the state of an idle id in a fixed window memory limiter for StateTTL
+	// after its window expires if set, including its tier, so a repeat offender is remembered
+	// across gaps without a longer window. The state is reclaimed after StateTTL without Get.
+	// By default the record is kept for its duration, and the tier for double the duration
+	// after the last escalation. The redis limiter ignores it.
+	StateTTL time.Duration
+
+	// WindowHistorySize keeps the used counts of the last WindowHistorySize completed windows
+	// of every id in a fixed window memory limiter if set, see Limiter.WindowHistory.
+	// It costs up to WindowHistorySize ints per id, and it is at most 64.
+	WindowHistorySize int
+
+	// OverLimitRemaining is what Result.Remaining reports for a denied request: -1 by default,
+	// 0, or the negative count of the denied requests in the window, see OverLimitMode.
+	OverLimitRemaining OverLimitMode
+
+	// ExpvarName publishes the Metrics of the limiter as an expvar with the name if set,
+	// so it can be seen in /debug/vars. If limiters are created with the same name,
+	// the last one is published.
+	ExpvarName string
+
+	// ProbeKeys are the ids of synthetic monitors, a monitoring aid. Get of a probe id runs
+	// the backend call and the Result assembly as usual, so it fails if the backend fails,
+	// but its record is removed after the call, so it is always allowed with the full quota
+	// (Remaining equals Total) and never throttled.
+	ProbeKeys []string
+
+	// RenameOverwrite lets Rename replace the record of the new id, by default Rename fails.
+	RenameOverwrite bool
+
+	// DistinctThreshold blocks a source of Limiter.AddDistinct for Duration if set,
+	// when it has tried more than DistinctThreshold distinct sub-ids in a Duration,
+	// a credential stuffing signature.
+	DistinctThreshold int
+
+	// RefundOnError sets the consumption of a redis limiter Get that fails with a network or
+	// timeout error. The script may have counted the request before the reply is lost, so by
+	// default such a request is consumed: a request is granted at most once, and counted at least once.
+	// With RefundOnError, the limiter refunds the request to the window of the id in the best
+	// effort, so a request is counted at most once, but the refund can also return a request
+	// that was never counted, and a window never gets more than its total. The refund of a denied
+	// request also takes back its over limit count, and the escalation of the first denied request
+	// unless Options.EscalationCooldown is set; a top tier block is kept.
+	// A redis error reply, an invalid result or ErrCircuitOpen is never refunded, and the sliding
+	// window and credits redis limiters never refund.
+	RefundOnError bool
 }
 
 // Result of limiter.Get
 type Result struct {
 	Total     int           // It Equals Options.Max, or policy max
-	Remaining int           // It will always >= -1
+	Remaining int           // It will always >= -1, unless Options.OverLimitRemaining is OverLimitTrueOverflow
 	Duration  time.Duration // It Equals Options.Duration, or policy duration
 	Reset     time.Time     // The limit record reset time
+	Meta      []byte        // The meta set by Limiter.SetMeta, nil if not set
+	// Used is the count of allowed requests in the current window, at most Total.
+	// A denied request is not counted.
+	Used int
+	// FirstWindow is true in the first window of an id, and false after the window resets.
+	// An id is new again after Remove, or when its record expires (double the duration
+	// after the last window started). It is reported by fixed window limiters only.
+	FirstWindow bool
+	// SoftExceeded is true if the request is allowed but over the soft cap of Options.SoftRatio.
+	SoftExceeded bool
+	// HardExceeded is true if the request is denied, the same as Remaining < 0 by default.
+	// The X-RateLimit headers always report the hard cap, a soft exceeded request
+	// can add a warning header, and only a hard exceeded request should get 429.
+	HardExceeded bool
+}
+
+// Allowed reports whether the request is allowed. The last allowed request of a window
+// has Remaining 0 and is allowed, the first denied one has Remaining -1,
+// or 0 with Options.OverLimitRemaining OverLimitZero.
+func (r Result) Allowed() bool {
+	return r.Remaining >= 0 && !r.HardExceeded
 }
 
 // New returns a Limiter instance with given options.
-// If options.Client omit, the limiter is a memory limiter
+// If options.Client omit, the limiter is a memory limiter,
+// or it is a redis limiter, and New panics if the lua scripts can't be loaded to redis.
+// New also panics if options.SoftRatio is out of range.
 func New(opts Options) *Limiter {
+	if !(opts.SoftRatio >= 0 && opts.SoftRatio < 1) {
+		panic(errors.New("ratelimiter: SoftRatio must be between 0 and 1"))
+	}
 	if opts.Prefix == "" {
 		opts.Prefix = "LIMIT:"
 	}
@@ -102,29 +326,115 @@ func New(opts Options) *Limiter {
 	if opts.Duration <= 0 {
 		opts.Duration = time.Minute
 	}
-	if opts.Client == nil {
-		return newMemoryLimiter(&opts)
+	if opts.TopTierBlockCount > 0 && opts.TopTierBlockPenalty < time.Millisecond {
+		opts.TopTierBlockPenalty = opts.Duration
+	}
+	if opts.WindowHistorySize > maxWindowHistorySize {
+		opts.WindowHistorySize = maxWindowHistorySize
+	}
+
+	var b *breaker
+	if opts.Client != nil && opts.BreakerThreshold > 0 {
+		if opts.BreakerWindow <= 0 {
+			opts.BreakerWindow = 10 * time.Second
+		}
+		if opts.BreakerCooldown <= 0 {
+			opts.BreakerCooldown = 5 * time.Second
+		}
+		b = &breaker{
+			threshold: opts.BreakerThreshold,
+			window:    opts.BreakerWindow,
+			cooldown:  opts.BreakerCooldown,
+		}
+		opts.Client = &breakerClient{opts.Client, b}
+	}
+
+	var backend abstractLimiter
+	switch {
+	case opts.Algorithm == SlidingWindow && opts.Client == nil:
+		backend = newSlidingMemoryLimiter(&opts)
+	case opts.Algorithm == SlidingWindow:
+		backend = newSlidingRedisLimiter(&opts)
+	case opts.Algorithm == Credits && opts.Client == nil:
+		backend = newCreditsMemoryLimiter(&opts)
+	case opts.Algorithm == Credits:
+		backend = newCreditsRedisLimiter(&opts)
+	case opts.Client == nil:
+		backend = newMemoryLimiter(&opts)
+	default:
+		backend = newRedisLimiter(&opts)
+	}
+
+	l := &Limiter{
+		abstractLimiter: backend,
+		prefix:          opts.Prefix,
+		max:             opts.Max,
+		duration:        opts.Duration,
+		snapshotWriter:  opts.SnapshotWriter,
+		breaker:         b,
+		failOpen:        opts.BreakerFailOpen,
+		serialize:       opts.SerializeAll,
+		softRatio:       opts.SoftRatio,
+		renameOverwrite: opts.RenameOverwrite,
+		duplicateTiers:  opts.DuplicateTiers,
+		counters:        &counters{},
+
+		distinctThreshold: opts.DistinctThreshold,
+		overLimit:         opts.OverLimitRemaining,
+		done:              make(chan struct{}),
+	}
+	if opts.AdaptiveLatencyTarget > 0 {
+		l.adaptive = newAdaptive(&opts)
+	}
+	if len(opts.ProbeKeys) > 0 {
+		l.probeKeys = make(map[string]bool, len(opts.ProbeKeys))
+		for _, id := range opts.ProbeKeys {
+			l.probeKeys[id] = true
+		}
+	}
+	if _, ok := l.abstractLimiter.(snapshotter); ok && opts.SnapshotWriter != nil && opts.SnapshotInterval > 0 {
+		l.snapshotStopped = make(chan struct{})
+		go l.snapshotLoop(opts.SnapshotInterval)
+	}
+	if opts.ExpvarName != "" {
+		publishExpvar(opts.ExpvarName, l)
 	}
-	return newRedisLimiter(&opts)
+	return l
 }
 
+// ErrTooManyKeys is returned by Get for a new id when the limiter has Options.MaxActiveKeys records.
+var ErrTooManyKeys = errors.New("ratelimiter: too many keys")
+
 type abstractLimiter interface {
 	getLimit(key string, policy ...int) ([]interface{}, error)
 	removeLimit(key string) error
 }
 
-func newRedisLimiter(opts *Options) *Limiter {
-	sha1, err := opts.Client.RateScriptLoad(lua)
-	if err != nil {
-		panic(err)
-	}
+func newRedisLimiter(opts *Options) *redisLimiter {
 	r := &redisLimiter{
-		rc:       opts.Client,
-		sha1:     sha1,
-		max:      strconv.FormatInt(int64(opts.Max), 10),
-		duration: strconv.FormatInt(int64(opts.Duration/time.Millisecond), 10),
+		rc:               opts.Client,
+		sha1:             loadScript(opts, lua),
+		metaSha1:         loadScript(opts, metaLua),
+		renameSha1:       loadScript(opts, renameLua),
+		blockSha1:        loadScript(opts, blockLua),
+		lastAccessSha1:   loadScript(opts, lastAccessLua),
+		notEscalatedSha1: loadScript(opts, notEscalatedLua),
+		peekSha1:         loadScript(opts, peekLua),
+		setPolicySha1:    loadScript(opts, setPolicyLua),
+		distinctSha1:     loadScript(opts, distinctLua),
+		removeSha1:       loadScript(opts, removeLua),
+		max:              strconv.FormatInt(int64(opts.Max), 10),
+		duration:         strconv.FormatInt(int64(opts.Duration/time.Millisecond), 10),
+		topBlockCount:    strconv.FormatInt(int64(opts.TopTierBlockCount), 10),
+		topBlockPenalty:  strconv.FormatInt(int64(opts.TopTierBlockPenalty/time.Millisecond), 10),
+
+		escalationCooldown: strconv.FormatInt(int64(opts.EscalationCooldown/time.Millisecond), 10),
+		refund:             opts.RefundOnError,
 	}
-	return &Limiter{r, opts.Prefix}
+	if r.refund {
+		r.refundSha1 = loadScript(opts, refundLua)
+	}
+	return r
 }
 
 // Get get a limiter result for id. support custom limiter policy.
@@ -145,27 +455,98 @@ Get get a limiter result with custom limiter policy:
     id := "id-123456"
     policy := []int{100, 60000, 50, 60000, 50, 120000}
     res, err := limiter.Get(id, policy...)
+
+If the policy of an id changes between calls, the live window keeps the total and duration
+it was created with, and the new policy takes effect from the next window.
+The escalated tier is kept and limited to the last tier of the new policy.
+
+A denied request is not an error. Get returns a nil error with HardExceeded true
+(and Remaining -1 by default, see Options.OverLimitRemaining) when id is over the limit,
+whatever the algorithm or the tier.
+A non-nil error means Get can't decide: an invalid policy, a backend failure,
+ErrCircuitOpen, ErrTooManyKeys or ErrDrained, and the Result is zero then.
 */
 func (l *Limiter) Get(id string, policy ...int) (Result, error) {
+	return l.get(id, l.getLimit, policy...)
+}
+
+// get runs getLimit of a backend for id, and builds its Result.
+func (l *Limiter) get(id string, getLimit func(key string, policy ...int) ([]interface{}, error), policy ...int) (Result, error) {
 	var result Result
 	key := l.prefix + id
 
-	if odd := len(policy) % 2; odd == 1 {
-		return result, errors.New("ratelimiter: must be paired values")
+	if l.serialize {
+		l.serial.Lock()
+		defer l.serial.Unlock()
+	}
+	policy, err := l.policy(policy...)
+	if err != nil {
+		return result, err
 	}
 
-	res, err := l.getLimit(key, policy...)
+	res, err := getLimit(key, policy...)
+	if err == ErrCircuitOpen && l.failOpen {
+		result = l.freshResult(policy...)
+		l.count(result)
+		return result, nil
+	}
 	if err != nil {
 		return result, err
 	}
+	probe := l.probeKeys[id]
+	if probe {
+		if err = l.removeLimit(key); err != nil {
+			return result, err
+		}
+	}
+
+	result = l.result(res)
+	if probe {
+		result.Remaining = result.Total
+		result.Used = 0
+		result.HardExceeded = false
+		result.SoftExceeded = false
+	}
+	l.count(result)
+	return result, nil
+}
 
-	result = Result{}
+// policy checks the policy of Get, and applies Options.DuplicateTiers and the adaptive max count.
+func (l *Limiter) policy(policy ...int) ([]int, error) {
+	if err := ValidatePolicy(policy...); err != nil {
+		return nil, err
+	}
+	if len(policy) > 2 {
+		return Policy(policy).tiers(l.duplicateTiers)
+	}
+	if l.adaptive != nil && len(policy) == 0 {
+		return []int{l.adaptive.effectiveMax(), int(l.duration / time.Millisecond)}, nil
+	}
+	return policy, nil
+}
+
+// result builds the Result from the result slice of a backend.
+func (l *Limiter) result(res []interface{}) Result {
+	result := Result{}
+	overflow := 0
+	// the allowed count of the window, -1 if the backend doesn't count it.
+	allowed := -1
 	switch res[3].(type) {
 	case time.Time: // result from memory limiter
 		result.Remaining = res[0].(int)
 		result.Total = res[1].(int)
 		result.Duration = res[2].(time.Duration)
 		result.Reset = res[3].(time.Time)
+		if len(res) > 5 {
+			result.Meta, _ = res[4].([]byte)
+			result.FirstWindow, _ = res[5].(bool)
+		}
+		if len(res) > 6 {
+			overflow, _ = res[6].(int)
+		}
+		if len(res) > 7 {
+			allowed, _ = res[7].(int)
+		}
 	default: // result from redis limiter
 		result.Remaining = int(res[0].(int64))
 		result.Total = int(res[1].(int64))
@@ -174,30 +555,133 @@ func (l *Limiter) Get(id string, policy ...int) (Result, error) {
 		timestamp := res[3].(int64)
 		sec := timestamp / 1000
 		result.Reset = time.Unix(sec, (timestamp-(sec*1000))*1e6)
+		if len(res) > 5 {
+			if meta, ok := res[4].(string); ok {
+				result.Meta = []byte(meta)
+			}
+			first, _ := res[5].(int64)
+			result.FirstWindow = first == 1
+		}
+		if len(res) > 7 {
+			count, _ := res[7].(int64)
+			overflow = int(count)
+		}
+		if len(res) > 8 {
+			count, _ := res[8].(int64)
+			allowed = int(count)
+		}
 	}
+	result.Used = used(result.Total, result.Remaining)
+	if allowed >= 0 {
+		result.Used = allowed
+		if result.Used > result.Total {
+			result.Used = result.Total
+		}
+	}
+	result.HardExceeded = result.Remaining < 0
+	if result.HardExceeded {
+		result.Remaining = l.overLimit.remaining(overflow)
+	}
+	if l.softRatio > 0 && !result.HardExceeded {
+		result.SoftExceeded = float64(result.Used) > float64(result.Total)*l.softRatio
+	}
+	return result
+}
+
+// GetIf get a limiter result for id only if cond is true. If cond is false,
+// the backend is not called and nothing is consumed, it returns an allowed Result
+// with the full quota of the first policy (or Options.Max and Options.Duration).
+func (l *Limiter) GetIf(cond bool, id string, policy ...int) (Result, error) {
+	if cond {
+		return l.Get(id, policy...)
+	}
+	if err := ValidatePolicy(policy...); err != nil {
+		return Result{}, err
+	}
+	result := l.freshResult(policy...)
+	result.Remaining = result.Total
+	result.Used = 0
 	return result, nil
 }
 
+// freshResult returns the Result of a fresh window without calling the backend.
+func (l *Limiter) freshResult(policy ...int) Result {
+	total, duration := l.EffectiveMax(), l.duration
+	if len(policy) > 1 {
+		total, duration = policy[0], time.Duration(policy[1])*time.Millisecond
+	}
+	return Result{
+		Total:     total,
+		Remaining: total - 1,
+		Used:      1,
+		Duration:  duration,
+		Reset:     time.Now().Add(duration),
+	}
+}
+
+// used returns the count of allowed requests for a window of a backend that doesn't count them.
+func used(total, remaining int) int {
+	if remaining < 0 {
+		return total
+	}
+	return total - remaining
+}
+
 // Remove remove limiter record for id
 func (l *Limiter) Remove(id string) error {
+	if l.serialize {
+		l.serial.Lock()
+		defer l.serial.Unlock()
+	}
 	return l.removeLimit(l.prefix + id)
 }
 
 type redisLimiter struct {
-	sha1, max, duration string
-	rc                  RedisClient
+	sha1, metaSha1, renameSha1, blockSha1, lastAccessSha1, notEscalatedSha1, peekSha1, max, duration string
+	setPolicySha1, distinctSha1, refundSha1, removeSha1                                              string
+	topBlockCount, topBlockPenalty, escalationCooldown                                               string
+	refund                                                                                           bool
+	rc                                                                                               RedisClient
 }
 
+// removeLimit deletes the keys of the record in one script, a concurrent Get sees all of them or none.
+// The stored policy and the distinct sets of the id are kept, as the memory limiter keeps them.
 func (r *redisLimiter) removeLimit(key string) error {
-	return r.rc.RateDel(key)
+	keys := []string{key, fmt.Sprintf("{%s}:S", key), fmt.Sprintf("{%s}:M", key), fmt.Sprintf("{%s}:F", key), fmt.Sprintf("{%s}:T", key), fmt.Sprintf("{%s}:E", key)}
+	_, err := evalScript(r.rc, r.removeSha1, removeLua, keys)
+	return err
 }
 
 func (r *redisLimiter) getLimit(key string, policy ...int) ([]interface{}, error) {
-	keys := []string{key, fmt.Sprintf("{%s}:S", key)}
-	capacity := 3
+	keys, args, err := r.limitArgs(key, policy...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := evalLimit(r.rc, r.sha1, lua, keys, args...)
+	if err != nil && r.refund && isTransportErr(err) {
+		// the first denied request of a window escalates the id, unless there is a cooldown.
+		escalated := "0"
+		if len(policy) > 2 && r.escalationCooldown == "0" {
+			escalated = "1"
+		}
+		// the refund bypasses the breaker, it is no success after the error of the limit script.
+		rc := r.rc
+		if bc, ok := rc.(*breakerClient); ok {
+			rc = bc.RedisClient
+		}
+		// the result of refund is ignored, the error of Get is the error of the limit script.
+		evalScript(rc, r.refundSha1, refundLua, keys[:2], escalated)
+	}
+	return res, err
+}
+
+// limitArgs returns the keys and args of the limit script.
+func (r *redisLimiter) limitArgs(key string, policy ...int) ([]string, []interface{}, error) {
+	keys := []string{key, fmt.Sprintf("{%s}:S", key), fmt.Sprintf("{%s}:M", key), fmt.Sprintf("{%s}:F", key), fmt.Sprintf("{%s}:T", key), fmt.Sprintf("{%s}:P", key), fmt.Sprintf("{%s}:E", key)}
+	capacity := 7
 	length := len(policy)
 	if length > 2 {
-		capacity = length + 1
+		capacity = length + 5
 	}
 
 	args := make([]interface{}, capacity, capacity)
@@ -206,26 +690,30 @@ func (r *redisLimiter) getLimit(key string, policy ...int) ([]interface{}, error
 		args[1] = r.max
 		args[2] = r.duration
 	} else {
+		if err := ValidatePolicy(policy...); err != nil {
+			return nil, nil, err
+		}
 		for i, val := range policy {
-			if val <= 0 {
-				return nil, errors.New("ratelimiter: must be positive integer")
-			}
 			args[i+1] = strconv.FormatInt(int64(val), 10)
 		}
 	}
-
-	res, err := r.rc.RateEvalSha(r.sha1, keys, args...)
-	if err != nil && isNoScriptErr(err) {
-		// try to load lua for cluster client and ring client for nodes changing.
-		_, err = r.rc.RateScriptLoad(lua)
-		if err == nil {
-			res, err = r.rc.RateEvalSha(r.sha1, keys, args...)
-		}
+	args[capacity-4] = r.topBlockCount
+	args[capacity-3] = r.topBlockPenalty
+	args[capacity-2] = r.escalationCooldown
+	// the script reads the stored policy of a bare Get.
+	args[capacity-1] = "0"
+	if length == 0 {
+		args[capacity-1] = "1"
 	}
+	return keys, args, nil
+}
 
+// evalLimit runs a limit script and checks the result shape.
+func evalLimit(rc RedisClient, sha1, script string, keys []string, args ...interface{}) ([]interface{}, error) {
+	res, err := evalScript(rc, sha1, script, keys, args...)
 	if err == nil {
 		arr, ok := res.([]interface{})
-		if ok && len(arr) == 4 {
+		if ok && len(arr) >= 4 {
 			return arr, nil
 		}
 		err = errors.New("Invalid result")
@@ -233,6 +721,82 @@ func (r *redisLimiter) getLimit(key string, policy ...int) ([]interface{}, error
 	return nil, err
 }
 
+// loadScript loads a script to redis once for a client and returns its sha1, it panics if redis
+// refuses it. The limiters sharing a client share the load, and the sha1 of a script is computed
+// once for every client. With Options.LazyScriptLoad, it only computes the sha1.
+func loadScript(opts *Options, script string) string {
+	sha := scriptSha1(script)
+	if opts.LazyScriptLoad {
+		return sha
+	}
+
+	client := opts.Client
+	if bc, ok := client.(*breakerClient); ok {
+		client = bc.RedisClient
+	}
+	// only a pointer client is cached, any other client may not be a valid map key.
+	cacheable := reflect.ValueOf(client).Kind() == reflect.Ptr
+	key := scriptKey{client, sha}
+	if cacheable {
+		scripts.Lock()
+		loaded := scripts.loaded[key]
+		scripts.Unlock()
+		if loaded {
+			return sha
+		}
+	}
+
+	if _, err := opts.Client.RateScriptLoad(script); err != nil {
+		panic(err)
+	}
+	if cacheable {
+		scripts.Lock()
+		scripts.loaded[key] = true
+		scripts.Unlock()
+	}
+	return sha
+}
+
+// scriptSha1 returns the sha1 of script.
+func scriptSha1(script string) string {
+	scripts.Lock()
+	defer scripts.Unlock()
+	sha, ok := scripts.shas[script]
+	if !ok {
+		sum := sha1.Sum([]byte(script))
+		sha = hex.EncodeToString(sum[:])
+		scripts.shas[script] = sha
+	}
+	return sha
+}
+
+type scriptKey struct {
+	client RedisClient
+	sha1   string
+}
+
+// scripts are the sha1 of the scripts by script content, and the scripts loaded by every client.
+// The cache keeps a reference to every client that loads scripts, a process is expected to have
+// a few clients. If redis loses a script, evalScript loads it again with the same sha1.
+var scripts = struct {
+	sync.Mutex
+	shas   map[string]string
+	loaded map[scriptKey]bool
+}{shas: make(map[string]string), loaded: make(map[scriptKey]bool)}
+
+// evalScript runs a loaded script, and reloads it if redis lost it.
+func evalScript(rc RedisClient, sha1, script string, keys []string, args ...interface{}) (interface{}, error) {
+	res, err := rc.RateEvalSha(sha1, keys, args...)
+	if err != nil && isNoScriptErr(err) {
+		// try to load lua for cluster client and ring client for nodes changing.
+		_, err = rc.RateScriptLoad(script)
+		if err == nil {
+			res, err = rc.RateEvalSha(sha1, keys, args...)
+		}
+	}
+	return res, err
+}
+
 func genTimestamp() string {
 	time := time.Now().UnixNano() / 1e6
 	return strconv.FormatInt(time, 10)
@@ -242,35 +806,88 @@ func isNoScriptErr(err error) bool {
 	return strings.HasPrefix(err.Error(), "NOSCRIPT ")
 }
 
+// isTransportErr returns true if err is a network or timeout error, the script may have run
+// but its reply is lost, unlike a redis error reply.
+func isTransportErr(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
 // copy from ./ratelimiter.lua
 const lua string = `
 -- KEYS[1] target hash key
 -- KEYS[2] target status hash key
--- ARGV[n >= 3] current timestamp, max count, duration, max count, duration, ...
+-- KEYS[3] target meta key
+-- KEYS[4] target seen key
+-- KEYS[5] target top tier hits key
+-- KEYS[6] target stored policy hash key
+-- KEYS[7] target escalation cooldown key
+-- ARGV[n >= 7] current timestamp, max count, duration, max count, duration, ...,
+--   top tier block count, top tier block penalty, escalation cooldown,
+--   "1" if the policy is the default one
 
 -- HASH: KEYS[1]
 --   field:ct(count)
 --   field:lt(limit)
 --   field:dn(duration)
 --   field:rt(reset)
+--   field:fw(first window)
+--   field:la(last access)
+--   field:ov(over limit count)
+--   field:al(allowed count)
 
 local res = {}
-local policyCount = (#ARGV - 1) / 2
-local limit = redis.call('hmget', KEYS[1], 'ct', 'lt', 'dn', 'rt')
+local policy = {}
+for i = 2, #ARGV - 4 do
+  policy[#policy + 1] = ARGV[i]
+end
+-- a stored policy overrides the default one, see Limiter.SetPolicy
+if ARGV[#ARGV] == '1' then
+  local stored = redis.call('hmget', KEYS[6], 'mx', 'dn')
+  if stored[1] then
+    policy = {stored[1], stored[2]}
+  end
+end
+local policyCount = #policy / 2
+local blockCount = tonumber(ARGV[#ARGV - 3])
+local cooldown = tonumber(ARGV[#ARGV - 1])
+local blocked = false
+local limit = redis.call('hmget', KEYS[1], 'ct', 'lt', 'dn', 'rt', 'fw')
 
 if limit[1] then
 
   res[1] = tonumber(limit[1]) - 1
   res[2] = tonumber(limit[2])
-  res[3] = tonumber(limit[3]) or ARGV[3]
+  res[3] = tonumber(limit[3]) or tonumber(policy[2])
   res[4] = tonumber(limit[4])
+  res[6] = tonumber(limit[5]) or 0
 
   if policyCount > 1 and res[1] == -1 then
-    redis.call('incr', KEYS[2])
-    redis.call('pexpire', KEYS[2], res[3] * 2)
-    local index = tonumber(redis.call('get', KEYS[2]))
-    if index == 1 then
+    -- the window is at the top tier if the status has reached it
+    local top = (tonumber(redis.call('get', KEYS[2])) or 1) >= policyCount
+    -- an escalation step starts the cooldown, until then the id keeps its tier
+    if cooldown == 0 or redis.call('set', KEYS[7], 1, 'px', cooldown, 'nx') then
       redis.call('incr', KEYS[2])
+      local index = tonumber(redis.call('get', KEYS[2]))
+      if index == 1 then
+        redis.call('incr', KEYS[2])
+      end
+    end
+    redis.call('pexpire', KEYS[2], res[3] * 2)
+
+    if blockCount > 0 then
+      local hits = 0
+      if top then
+        hits = redis.call('incr', KEYS[5])
+      end
+      redis.call('pexpire', KEYS[5], res[3] * 2)
+      if hits >= blockCount then
+        redis.call('del', KEYS[5])
+        blocked = true
+      end
     end
   end
 
@@ -279,6 +896,25 @@ if limit[1] then
   else
     res[1] = -1
   end
+  if res[1] >= 0 then
+    redis.call('hincrby', KEYS[1], 'al', 1)
+  end
+  if res[1] == -1 then
+    res[8] = redis.call('hincrby', KEYS[1], 'ov', 1)
+  end
+
+  if blocked then
+    local penalty = tonumber(ARGV[#ARGV - 2])
+    res[3] = penalty
+    res[4] = tonumber(ARGV[1]) + penalty
+    res[6] = 0
+    res[8] = 1
+    redis.call('hmset', KEYS[1], 'ct', -1, 'dn', res[3], 'rt', res[4], 'fw', 0, 'ov', 1)
+    redis.call('pexpire', KEYS[1], penalty)
+    if redis.call('pttl', KEYS[4]) < penalty * 2 then
+      redis.call('set', KEYS[4], 1, 'px', penalty * 2)
+    end
+  end
 
 else
 
@@ -290,16 +926,62 @@ else
     end
   end
 
-  local total = tonumber(ARGV[index * 2])
+  local total = tonumber(policy[index * 2 - 1])
   res[1] = total - 1
   res[2] = total
-  res[3] = tonumber(ARGV[index * 2 + 1])
+  res[3] = tonumber(policy[index * 2])
   res[4] = tonumber(ARGV[1]) + res[3]
+  res[6] = 1 - redis.call('exists', KEYS[4])
 
-  redis.call('hmset', KEYS[1], 'ct', res[1], 'lt', res[2], 'dn', res[3], 'rt', res[4])
+  redis.call('hmset', KEYS[1], 'ct', res[1], 'lt', res[2], 'dn', res[3], 'rt', res[4], 'fw', res[6], 'al', 1)
+  redis.call('set', KEYS[4], 1, 'px', res[3] * 2)
   redis.call('pexpire', KEYS[1], res[3])
+  if redis.call('exists', KEYS[3]) == 1 then
+    redis.call('pexpire', KEYS[3], res[3] * 2)
+  end
 
 end
 
+redis.call('hset', KEYS[1], 'la', ARGV[1])
+res[5] = redis.call('get', KEYS[3])
+res[7] = 0
+res[8] = res[8] or 0
+res[9] = tonumber(redis.call('hget', KEYS[1], 'al')) or 0
 return res
 `
+
+const refundLua string = `
+-- KEYS[1] target hash key
+-- KEYS[2] target status key
+-- ARGV[1] "1" if the first denied request of the window escalated the id
+
+local limit = redis.call('hmget', KEYS[1], 'ct', 'lt', 'ov')
+if not limit[1] then
+  return false
+end
+local ov = tonumber(limit[3]) or 0
+if ov > 0 then
+  -- the request was denied, only the first denied request counted and escalated
+  redis.call('hincrby', KEYS[1], 'ov', -1)
+  if ov == 1 then
+    redis.call('hincrby', KEYS[1], 'ct', 1)
+    if ARGV[1] == '1' and (tonumber(redis.call('get', KEYS[2])) or 1) > 1 then
+      redis.call('decr', KEYS[2])
+    end
+  end
+  return 0
+end
+if tonumber(limit[1]) < tonumber(limit[2]) then
+  if (tonumber(redis.call('hget', KEYS[1], 'al')) or 0) > 0 then
+    redis.call('hincrby', KEYS[1], 'al', -1)
+  end
+  return redis.call('hincrby', KEYS[1], 'ct', 1)
+end
+return false
+`
+
+const removeLua string = `
+-- KEYS[1..6] target hash key, status key, meta key, seen key, top tier hits key, cooldown key
+
+return redis.call('del', unpack(KEYS))
+`
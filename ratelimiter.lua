@@ -1,30 +1,73 @@
 -- KEYS[1] target hash key
 -- KEYS[2] target status hash key
--- ARGV[n >= 3] current timestamp, max count, duration, max count, duration, ...
+-- KEYS[3] target meta key
+-- KEYS[4] target seen key
+-- KEYS[5] target top tier hits key
+-- KEYS[6] target stored policy hash key
+-- KEYS[7] target escalation cooldown key
+-- ARGV[n >= 7] current timestamp, max count, duration, max count, duration, ...,
+--   top tier block count, top tier block penalty, escalation cooldown,
+--   "1" if the policy is the default one
 
 -- HASH: KEYS[1]
 --   field:ct(count)
 --   field:lt(limit)
 --   field:dn(duration)
 --   field:rt(reset)
+--   field:fw(first window)
+--   field:la(last access)
+--   field:ov(over limit count)
+--   field:al(allowed count)
 
 local res = {}
-local policyCount = (#ARGV - 1) / 2
-local limit = redis.call('hmget', KEYS[1], 'ct', 'lt', 'dn', 'rt')
+local policy = {}
+for i = 2, #ARGV - 4 do
+  policy[#policy + 1] = ARGV[i]
+end
+-- a stored policy overrides the default one, see Limiter.SetPolicy
+if ARGV[#ARGV] == '1' then
+  local stored = redis.call('hmget', KEYS[6], 'mx', 'dn')
+  if stored[1] then
+    policy = {stored[1], stored[2]}
+  end
+end
+local policyCount = #policy / 2
+local blockCount = tonumber(ARGV[#ARGV - 3])
+local cooldown = tonumber(ARGV[#ARGV - 1])
+local blocked = false
+local limit = redis.call('hmget', KEYS[1], 'ct', 'lt', 'dn', 'rt', 'fw')
 
 if limit[1] then
 
   res[1] = tonumber(limit[1]) - 1
   res[2] = tonumber(limit[2])
-  res[3] = tonumber(limit[3]) or ARGV[3]
+  res[3] = tonumber(limit[3]) or tonumber(policy[2])
   res[4] = tonumber(limit[4])
+  res[6] = tonumber(limit[5]) or 0
 
   if policyCount > 1 and res[1] == -1 then
-    redis.call('incr', KEYS[2])
-    redis.call('pexpire', KEYS[2], res[3] * 2)
-    local index = tonumber(redis.call('get', KEYS[2]))
-    if index == 1 then
+    -- the window is at the top tier if the status has reached it
+    local top = (tonumber(redis.call('get', KEYS[2])) or 1) >= policyCount
+    -- an escalation step starts the cooldown, until then the id keeps its tier
+    if cooldown == 0 or redis.call('set', KEYS[7], 1, 'px', cooldown, 'nx') then
       redis.call('incr', KEYS[2])
+      local index = tonumber(redis.call('get', KEYS[2]))
+      if index == 1 then
+        redis.call('incr', KEYS[2])
+      end
+    end
+    redis.call('pexpire', KEYS[2], res[3] * 2)
+
+    if blockCount > 0 then
+      local hits = 0
+      if top then
+        hits = redis.call('incr', KEYS[5])
+      end
+      redis.call('pexpire', KEYS[5], res[3] * 2)
+      if hits >= blockCount then
+        redis.call('del', KEYS[5])
+        blocked = true
+      end
     end
   end
 
@@ -33,6 +76,25 @@ if limit[1] then
   else
     res[1] = -1
   end
+  if res[1] >= 0 then
+    redis.call('hincrby', KEYS[1], 'al', 1)
+  end
+  if res[1] == -1 then
+    res[8] = redis.call('hincrby', KEYS[1], 'ov', 1)
+  end
+
+  if blocked then
+    local penalty = tonumber(ARGV[#ARGV - 2])
+    res[3] = penalty
+    res[4] = tonumber(ARGV[1]) + penalty
+    res[6] = 0
+    res[8] = 1
+    redis.call('hmset', KEYS[1], 'ct', -1, 'dn', res[3], 'rt', res[4], 'fw', 0, 'ov', 1)
+    redis.call('pexpire', KEYS[1], penalty)
+    if redis.call('pttl', KEYS[4]) < penalty * 2 then
+      redis.call('set', KEYS[4], 1, 'px', penalty * 2)
+    end
+  end
 
 else
 
@@ -44,15 +106,25 @@ else
     end
   end
 
-  local total = tonumber(ARGV[index * 2])
+  local total = tonumber(policy[index * 2 - 1])
   res[1] = total - 1
   res[2] = total
-  res[3] = tonumber(ARGV[index * 2 + 1])
+  res[3] = tonumber(policy[index * 2])
   res[4] = tonumber(ARGV[1]) + res[3]
+  res[6] = 1 - redis.call('exists', KEYS[4])
 
-  redis.call('hmset', KEYS[1], 'ct', res[1], 'lt', res[2], 'dn', res[3], 'rt', res[4])
+  redis.call('hmset', KEYS[1], 'ct', res[1], 'lt', res[2], 'dn', res[3], 'rt', res[4], 'fw', res[6], 'al', 1)
+  redis.call('set', KEYS[4], 1, 'px', res[3] * 2)
   redis.call('pexpire', KEYS[1], res[3])
+  if redis.call('exists', KEYS[3]) == 1 then
+    redis.call('pexpire', KEYS[3], res[3] * 2)
+  end
 
 end
 
+redis.call('hset', KEYS[1], 'la', ARGV[1])
+res[5] = redis.call('get', KEYS[3])
+res[7] = 0
+res[8] = res[8] or 0
+res[9] = tonumber(redis.call('hget', KEYS[1], 'al')) or 0
 return res
@@ -4,7 +4,9 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"net"
 	"sort"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -48,6 +50,21 @@ func (c *redisClient) RateScriptLoad(script string) (string, error) {
 	return c.ScriptLoad(script).Result()
 }
 
+// lostReplyClient runs the scripts on redis, but loses the reply of the next limit script if lose is set.
+type lostReplyClient struct {
+	redisClient
+	lose bool
+}
+
+func (c *lostReplyClient) RateEvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	res, err := c.redisClient.RateEvalSha(sha1, keys, args...)
+	if c.lose && len(keys) == 7 {
+		c.lose = false
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	}
+	return res, err
+}
+
 // Implements RedisClient for redis.ClusterClient
 type clusterClient struct {
 	*redis.ClusterClient
@@ -651,6 +668,539 @@ func TestRedisRatelimiter(t *testing.T) {
 		assert.Equal(time.Millisecond*300, res.Duration)
 
 	})
+	t.Run("Result.FirstWindow", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+		policy := []int{2, 100}
+
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.True(res.FirstWindow)
+		res, err = limiter.Get(id, policy...)
+		assert.True(res.FirstWindow)
+
+		time.Sleep(res.Duration + time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(1, res.Remaining)
+		assert.False(res.FirstWindow)
+
+		assert.Nil(limiter.Remove(id))
+		res, err = limiter.Get(id, policy...)
+		assert.True(res.FirstWindow)
+	})
+	t.Run("limiter.Rename", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var oldID = genID()
+		var newID = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+		policy := []int{2, 100, 5, 100}
+
+		assert.Equal("ratelimiter: no limit record for id", limiter.Rename(oldID, newID).Error())
+
+		limiter.Get(oldID, policy...)
+		limiter.Get(oldID, policy...)
+		limiter.Get(oldID, policy...)
+		time.Sleep(110 * time.Millisecond)
+		res, err := limiter.Get(oldID, policy...)
+		assert.Nil(err)
+		assert.Equal(5, res.Total)
+
+		limiter.Get(newID)
+		assert.Equal(ratelimiter.ErrIDExists, limiter.Rename(oldID, newID))
+		assert.Nil(limiter.Remove(newID))
+
+		assert.Nil(limiter.Rename(oldID, newID))
+		res, err = limiter.Get(newID, policy...)
+		assert.Nil(err)
+		assert.Equal(5, res.Total)
+		assert.Equal(3, res.Remaining)
+
+		res, err = limiter.Get(oldID, policy...)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+		assert.True(res.FirstWindow)
+
+		// the stored policy and the escalation cooldown move too.
+		oldID, newID = genID(), genID()
+		limiter = ratelimiter.New(ratelimiter.Options{
+			Client:             &redisClient{client},
+			EscalationCooldown: time.Second,
+		})
+		assert.Nil(limiter.SetPolicy(oldID, 3, time.Second))
+		limiter.Get(oldID, 1, 100, 5, 100)
+		limiter.Get(oldID, 1, 100, 5, 100)
+		assert.Nil(limiter.Rename(oldID, newID))
+		for _, suffix := range []string{"}:P", "}:E"} {
+			assert.Equal(int64(0), client.Exists("{LIMIT:"+oldID+suffix).Val())
+			assert.Equal(int64(1), client.Exists("{LIMIT:"+newID+suffix).Val())
+		}
+	})
+	t.Run("limiter.BlockMany", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id1, id2, id3 = genID(), genID(), genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+		policy := []int{5, 1000}
+		limiter.Get(id1, policy...)
+
+		err := limiter.BlockMany([]ratelimiter.BlockEntry{
+			{ID: id1, Penalty: 100 * time.Millisecond},
+			{ID: id2, Penalty: 200 * time.Millisecond},
+		})
+		assert.Nil(err)
+
+		for i := 0; i < 3; i++ {
+			res, err := limiter.Get(id1, policy...)
+			assert.Nil(err)
+			assert.Equal(-1, res.Remaining)
+			assert.Equal(5, res.Total)
+			assert.Equal(1, res.Used)
+			res, err = limiter.Get(id2, policy...)
+			assert.Nil(err)
+			assert.Equal(-1, res.Remaining)
+			assert.Equal(0, res.Used)
+		}
+		res, err := limiter.Get(id3, policy...)
+		assert.Nil(err)
+		assert.Equal(4, res.Remaining)
+
+		time.Sleep(110 * time.Millisecond)
+		res, err = limiter.Get(id1, policy...)
+		assert.Equal(4, res.Remaining)
+		res, err = limiter.Get(id2, policy...)
+		assert.Equal(-1, res.Remaining)
+
+		time.Sleep(100 * time.Millisecond)
+		res, err = limiter.Get(id2, policy...)
+		assert.Equal(4, res.Remaining)
+		assert.Equal(1, res.Used)
+		// the block sets the seen key as the limit script does
+		assert.False(res.FirstWindow)
+	})
+	t.Run("limiter.Get with ProbeKeys", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var probe = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client:    &redisClient{client},
+			Max:       1,
+			ProbeKeys: []string{probe},
+		})
+
+		for i := 0; i < 3; i++ {
+			res, err := limiter.Get(probe)
+			assert.Nil(err)
+			assert.Equal(1, res.Total)
+			assert.Equal(1, res.Remaining)
+		}
+		assert.Equal(int64(0), client.Exists("LIMIT:"+probe).Val())
+	})
+	t.Run("limiter.LastAccess", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+
+		_, ok, err := limiter.LastAccess(id)
+		assert.Nil(err)
+		assert.False(ok)
+
+		limiter.Get(id)
+		first, ok, err := limiter.LastAccess(id)
+		assert.Nil(err)
+		assert.True(ok)
+		assert.True(first.After(time.Now().Add(-time.Second)))
+
+		time.Sleep(10 * time.Millisecond)
+		limiter.Get(id)
+		last, ok, err := limiter.LastAccess(id)
+		assert.True(last.After(first))
+
+		assert.Nil(limiter.Remove(id))
+		_, ok, err = limiter.LastAccess(id)
+		assert.False(ok)
+	})
+	t.Run("limiter.GetIfNotEscalated", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+		policy := []int{2, 100, 5, 100}
+
+		res, ok, err := limiter.GetIfNotEscalated(id, policy...)
+		assert.Nil(err)
+		assert.True(ok)
+		assert.Equal(1, res.Remaining)
+		limiter.GetIfNotEscalated(id, policy...)
+		res, ok, err = limiter.GetIfNotEscalated(id, policy...)
+		assert.True(ok)
+		assert.Equal(-1, res.Remaining)
+
+		res, ok, err = limiter.GetIfNotEscalated(id, policy...)
+		assert.Nil(err)
+		assert.False(ok)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(2, res.Total)
+
+		time.Sleep(110 * time.Millisecond)
+		res, ok, err = limiter.GetIfNotEscalated(id, policy...)
+		assert.False(ok)
+		assert.Equal(5, res.Total)
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(5, res.Total)
+		assert.Equal(4, res.Remaining)
+	})
+	t.Run("limiter.Peek", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+		policy := []int{2, 100, 5, 100}
+
+		res, err := limiter.Peek(id, policy...)
+		assert.Nil(err)
+		assert.Equal(ratelimiter.Result{}, res)
+		assert.Equal(int64(0), client.Exists("LIMIT:"+id).Val())
+
+		limiter.Get(id, policy...)
+		res, err = limiter.Peek(id, policy...)
+		assert.Nil(err)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+		res, err = limiter.Peek(id, policy...)
+		assert.Equal(-1, res.Remaining)
+
+		time.Sleep(110 * time.Millisecond)
+		res, err = limiter.Peek(id, policy...)
+		assert.Equal(ratelimiter.Result{}, res)
+		res, err = limiter.PeekOrCreate(id, policy...)
+		assert.Nil(err)
+		assert.Equal(5, res.Total)
+		assert.Equal(5, res.Remaining)
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(4, res.Remaining)
+	})
+	t.Run("ratelimiter.New with TopTierBlockCount", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client:              &redisClient{client},
+			TopTierBlockCount:   2,
+			TopTierBlockPenalty: 300 * time.Millisecond,
+		})
+		policy := []int{2, 100, 1, 100}
+
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+		time.Sleep(110 * time.Millisecond)
+		limiter.Get(id, policy...)
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(100*time.Millisecond, res.Duration)
+
+		time.Sleep(110 * time.Millisecond)
+		limiter.Get(id, policy...)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(-1, res.Remaining)
+		assert.Equal(300*time.Millisecond, res.Duration)
+
+		time.Sleep(150 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+
+		time.Sleep(260 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+	})
+	t.Run("limiter.SetPolicy", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+		other := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+
+		assert.Nil(limiter.SetPolicy(id, 3, 100*time.Millisecond))
+		res, err := other.Get(id)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(2, res.Remaining)
+		assert.Equal(100*time.Millisecond, res.Duration)
+
+		res, err = limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(1, res.Remaining)
+
+		assert.Nil(limiter.Remove(id))
+		res, err = limiter.Get(id, 5, 1000)
+		assert.Nil(err)
+		assert.Equal(5, res.Total)
+
+		assert.Nil(limiter.Remove(id))
+		res, err = other.Get(id)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(int64(1), client.Exists("{LIMIT:"+id+"}:P").Val())
+
+		assert.Nil(other.ClearPolicy(id))
+		assert.Equal(int64(0), client.Exists("{LIMIT:"+id+"}:P").Val())
+		assert.Nil(limiter.Remove(id))
+		res, err = limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(100, res.Total)
+		assert.Equal(time.Minute, res.Duration)
+	})
+
+	t.Run("limiter.AddDistinct", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var source = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client:            &redisClient{client},
+			DistinctThreshold: 50,
+		})
+
+		for i := 0; i < 50; i++ {
+			limiter.AddDistinct(source, strconv.Itoa(i))
+			limiter.AddDistinct(source, strconv.Itoa(i))
+		}
+		count, err := limiter.DistinctCount(source)
+		assert.Nil(err)
+		assert.True(count >= 49 && count <= 51)
+
+		for i := 50; i < 60; i++ {
+			limiter.AddDistinct(source, strconv.Itoa(i))
+		}
+		res, err := limiter.Get(source)
+		assert.Nil(err)
+		assert.False(res.Allowed())
+	})
+
+	t.Run("ratelimiter.New with EscalationCooldown", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client:             &redisClient{client},
+			EscalationCooldown: 300 * time.Millisecond,
+		})
+		policy := []int{3, 50, 2, 50, 1, 50}
+		exhaust := func() int {
+			res, _ := limiter.Get(id, policy...)
+			for res.Remaining >= 0 {
+				res, _ = limiter.Get(id, policy...)
+			}
+			time.Sleep(60 * time.Millisecond)
+			return res.Total
+		}
+
+		start := time.Now()
+		assert.Equal(3, exhaust())
+		for time.Since(start) < 240*time.Millisecond {
+			assert.Equal(2, exhaust())
+		}
+		for time.Since(start) < 360*time.Millisecond {
+			exhaust()
+		}
+		assert.Equal(1, exhaust())
+	})
+
+	t.Run("ratelimiter.New with OverLimitRemaining", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for mode, expected := range map[ratelimiter.OverLimitMode][]int{
+			ratelimiter.OverLimitNegativeOne:  {1, 0, -1, -1},
+			ratelimiter.OverLimitZero:         {1, 0, 0, 0},
+			ratelimiter.OverLimitTrueOverflow: {1, 0, -1, -2},
+		} {
+			var id = genID()
+			limiter := ratelimiter.New(ratelimiter.Options{
+				Client:             &redisClient{client},
+				Max:                2,
+				OverLimitRemaining: mode,
+			})
+			var remaining []int
+			for i := 0; i < 4; i++ {
+				res, err := limiter.Get(id)
+				assert.Nil(err)
+				assert.Equal(i >= 2, res.HardExceeded)
+				remaining = append(remaining, res.Remaining)
+			}
+			assert.Equal(expected, remaining)
+		}
+	})
+
+	t.Run("limiter with RefundOnError", func(t *testing.T) {
+		t.Run("should refund a lost denied request", func(t *testing.T) {
+			assert := assert.New(t)
+
+			var id = genID()
+			lost := &lostReplyClient{redisClient: redisClient{client}}
+			limiter := ratelimiter.New(ratelimiter.Options{Client: lost, RefundOnError: true})
+			policy := []int{1, 1000, 5, 1000}
+			res, err := limiter.Get(id, policy...)
+			assert.Nil(err)
+			assert.Equal(0, res.Remaining)
+
+			lost.lose = true
+			_, err = limiter.Get(id, policy...)
+			assert.NotNil(err)
+			assert.Equal("0", client.HGet("LIMIT:"+id, "ct").Val())
+			assert.Equal("0", client.HGet("LIMIT:"+id, "ov").Val())
+			assert.Equal("1", client.Get("{LIMIT:"+id+"}:S").Val())
+		})
+
+		t.Run("should refund a lost allowed request", func(t *testing.T) {
+			assert := assert.New(t)
+
+			var id = genID()
+			lost := &lostReplyClient{redisClient: redisClient{client}, lose: true}
+			limiter := ratelimiter.New(ratelimiter.Options{Client: lost, RefundOnError: true})
+			policy := []int{1, 1000}
+			_, err := limiter.Get(id, policy...)
+			assert.NotNil(err)
+			assert.Equal("1", client.HGet("LIMIT:"+id, "ct").Val())
+			assert.Equal("0", client.HGet("LIMIT:"+id, "al").Val())
+
+			res, err := limiter.Get(id, policy...)
+			assert.Nil(err)
+			assert.Equal(0, res.Remaining)
+			assert.False(res.HardExceeded)
+		})
+	})
+
+	t.Run("limiter.SetMeta", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client: &redisClient{client},
+		})
+		policy := []int{2, 100}
+
+		assert.Equal("ratelimiter: no limit record for id", limiter.SetMeta(id, []byte("vip")).Error())
+
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Nil(res.Meta)
+		assert.Nil(limiter.SetMeta(id, []byte("vip")))
+		res, err = limiter.Get(id, policy...)
+		assert.Equal([]byte("vip"), res.Meta)
+
+		time.Sleep(res.Duration + time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(1, res.Remaining)
+		assert.Equal([]byte("vip"), res.Meta)
+
+		assert.Nil(limiter.Remove(id))
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(res.Meta)
+	})
+	t.Run("ratelimiter.New with SlidingWindow", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client:    &redisClient{client},
+			Algorithm: ratelimiter.SlidingWindow,
+		})
+		policy := []int{5, 200}
+
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(5, res.Total)
+		assert.Equal(4, res.Remaining)
+		assert.Equal(time.Millisecond*200, res.Duration)
+
+		// a burst at the end of the first fixed window
+		time.Sleep(150 * time.Millisecond)
+		for i := 3; i >= 0; i-- {
+			res, err = limiter.Get(id, policy...)
+			assert.Nil(err)
+			assert.Equal(i, res.Remaining)
+		}
+
+		// only the first request has left the sliding window
+		time.Sleep(60 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(0, res.Remaining)
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+
+		assert.Nil(limiter.Remove(id))
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(4, res.Remaining)
+
+		_, err = limiter.Get(id, 5, 200, 3, 400)
+		assert.Equal("ratelimiter: sliding window supports one policy only", err.Error())
+	})
+	t.Run("ratelimiter.New with Credits", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var id = genID()
+		limiter := ratelimiter.New(ratelimiter.Options{
+			Client:    &redisClient{client},
+			Algorithm: ratelimiter.Credits,
+		})
+		policy := []int{10, 1000}
+
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(10, res.Total)
+		assert.Equal(9, res.Remaining)
+		assert.Equal(time.Second, res.Duration)
+		for i := 8; i >= 5; i-- {
+			res, err = limiter.Get(id, policy...)
+			assert.Nil(err)
+			assert.Equal(i, res.Remaining)
+		}
+
+		// one credit is earned back every 100ms
+		time.Sleep(250 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(6, res.Remaining)
+
+		// credits are capped at total
+		time.Sleep(1100 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(9, res.Remaining)
+
+		assert.Nil(limiter.Remove(id))
+		_, err = limiter.Get(id, 5, 200, 3, 400)
+		assert.Equal("ratelimiter: credits supports one policy only", err.Error())
+	})
 	t.Run("ratelimiter.New, Chaos", func(t *testing.T) {
 		t.Run("10 limiters work for one id", func(t *testing.T) {
 			assert := assert.New(t)
@@ -0,0 +1,136 @@
+package ratelimiter
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lossyRedisClient counts the requests of the limit script and refunds them as the scripts do,
+// but replaces the reply of the limit script with err if set.
+type lossyRedisClient struct {
+	mockRedisClient
+	err   error
+	count map[string]int
+	calls [][]string
+}
+
+var errConnReset = &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+func (c *lossyRedisClient) RateEvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error) {
+	c.calls = append(c.calls, keys)
+	res, err := c.mockRedisClient.RateEvalSha(sha1, keys, args...)
+	if err != nil {
+		return res, err
+	}
+	if c.count == nil {
+		c.count = make(map[string]int)
+	}
+	limitSha1 := scriptSha1(lua)
+	refundSha1 := scriptSha1(refundLua)
+	switch sha1 {
+	case limitSha1:
+		ct, ok := c.count[keys[0]]
+		if !ok {
+			ct = 10
+		}
+		if ct > -1 {
+			ct--
+		}
+		c.count[keys[0]] = ct
+		if c.err != nil {
+			return nil, c.err
+		}
+		return []interface{}{int64(ct), int64(10), int64(1000), time.Now().Add(time.Second).UnixNano() / 1e6}, nil
+	case refundSha1:
+		if ct, ok := c.count[keys[0]]; ok && ct < 10 {
+			c.count[keys[0]] = ct + 1
+		}
+	}
+	return res, err
+}
+
+func TestRedisRefundOnError(t *testing.T) {
+	t.Run("redis limiter should consume a failed request by default", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &lossyRedisClient{err: errConnReset}
+		limiter := New(Options{Client: client})
+		_, err := limiter.Get("id")
+		assert.Equal("read tcp: connection reset by peer", err.Error())
+		assert.Equal(1, len(client.calls))
+
+		client.err = nil
+		res, err := limiter.Get("id")
+		assert.Nil(err)
+		assert.Equal(8, res.Remaining)
+	})
+
+	t.Run("redis limiter with RefundOnError should refund a failed request", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &lossyRedisClient{err: errConnReset}
+		limiter := New(Options{Client: client, RefundOnError: true})
+		_, err := limiter.Get("id")
+		assert.Equal("read tcp: connection reset by peer", err.Error())
+		assert.Equal(2, len(client.calls))
+		assert.Equal([]string{"LIMIT:id", "{LIMIT:id}:S"}, client.calls[1])
+
+		client.err = nil
+		res, err := limiter.Get("id")
+		assert.Nil(err)
+		assert.Equal(9, res.Remaining)
+	})
+
+	t.Run("redis limiter with RefundOnError should not refund a redis error reply", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &lossyRedisClient{err: errors.New("ERR Error running script")}
+		limiter := New(Options{Client: client, RefundOnError: true})
+		_, err := limiter.Get("id")
+		assert.Equal("ERR Error running script", err.Error())
+		assert.Equal(1, len(client.calls))
+
+		client.err = nil
+		res, err := limiter.Get("id")
+		assert.Nil(err)
+		assert.Equal(8, res.Remaining)
+	})
+
+	t.Run("redis limiter with RefundOnError should not refund ErrCircuitOpen", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &lossyRedisClient{err: errConnReset}
+		limiter := New(Options{Client: client, RefundOnError: true, BreakerThreshold: 1})
+		limiter.Get("id")
+		assert.Equal(BreakerOpen, limiter.BreakerState())
+		calls := len(client.calls)
+
+		_, err := limiter.Get("id")
+		assert.Equal(ErrCircuitOpen, err)
+		assert.Equal(calls, len(client.calls))
+	})
+
+	t.Run("redis limiter with RefundOnError should count the refunded request as a breaker failure", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &lossyRedisClient{err: errConnReset}
+		limiter := New(Options{Client: client, RefundOnError: true, BreakerThreshold: 2})
+		limiter.Get("id")
+		assert.Equal(BreakerClosed, limiter.BreakerState())
+		limiter.Get("id")
+		assert.Equal(BreakerOpen, limiter.BreakerState())
+	})
+
+	t.Run("isTransportErr should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.True(isTransportErr(errConnReset))
+		assert.False(isTransportErr(errors.New("Invalid result")))
+		assert.False(isTransportErr(errors.New("NOSCRIPT No matching script. Please use EVAL.")))
+		assert.False(isTransportErr(ErrCircuitOpen))
+	})
+}
@@ -0,0 +1,106 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIDExists is returned by Rename if the new id already has a limit record.
+var ErrIDExists = errors.New("ratelimiter: new id already exists")
+
+type renamer interface {
+	rename(oldKey, newKey string, overwrite bool) error
+}
+
+// Rename moves the limit record of oldID to newID atomically, including its policy status,
+// meta, stored policy and escalation cooldown, so newID keeps the remaining and tier of oldID,
+// and oldID starts fresh.
+// It fails with ErrIDExists if newID has a record, unless Options.RenameOverwrite is set.
+// It is supported by fixed window limiters only, and the redis limiter doesn't support
+// redis cluster, because the records of two ids are in different slots.
+func (l *Limiter) Rename(oldID, newID string) error {
+	r, ok := l.abstractLimiter.(renamer)
+	if !ok {
+		return errors.New("ratelimiter: rename is only supported by fixed window limiter")
+	}
+	if oldID == newID {
+		return nil
+	}
+	return r.rename(l.prefix+oldID, l.prefix+newID, l.renameOverwrite)
+}
+
+// renamer interface
+func (m *memoryLimiter) rename(oldKey, newKey string, overwrite bool) error {
+	oldStatusKey := "{" + oldKey + "}:S"
+	newStatusKey := "{" + newKey + "}:S"
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.store[oldKey]
+	if !ok {
+		return errNoRecord
+	}
+	if _, ok := m.store[newKey]; ok && !overwrite {
+		return ErrIDExists
+	}
+	m.store[newKey] = item
+	delete(m.store, oldKey)
+	if status, ok := m.status[oldStatusKey]; ok {
+		m.status[newStatusKey] = status
+		delete(m.status, oldStatusKey)
+	} else {
+		delete(m.status, newStatusKey)
+	}
+	if until, ok := m.cooldowns[oldStatusKey]; ok {
+		m.cooldowns[newStatusKey] = until
+		delete(m.cooldowns, oldStatusKey)
+	} else {
+		delete(m.cooldowns, newStatusKey)
+	}
+	return nil
+}
+
+// renamer interface
+func (r *redisLimiter) rename(oldKey, newKey string, overwrite bool) error {
+	keys := make([]string, 0, 14)
+	for _, key := range []string{oldKey, newKey} {
+		keys = append(keys, key, fmt.Sprintf("{%s}:S", key), fmt.Sprintf("{%s}:M", key), fmt.Sprintf("{%s}:F", key),
+			fmt.Sprintf("{%s}:T", key), fmt.Sprintf("{%s}:P", key), fmt.Sprintf("{%s}:E", key))
+	}
+	flag := "0"
+	if overwrite {
+		flag = "1"
+	}
+	res, err := evalScript(r.rc, r.renameSha1, renameLua, keys, flag)
+	if err != nil {
+		return err
+	}
+	switch n, _ := res.(int64); n {
+	case 1:
+		return nil
+	case -1:
+		return ErrIDExists
+	default:
+		return errNoRecord
+	}
+}
+
+const renameLua string = `
+-- KEYS[1..7] old hash key, status key, meta key, seen key, top tier hits key, stored policy key, cooldown key
+-- KEYS[8..14] new hash key, status key, meta key, seen key, top tier hits key, stored policy key, cooldown key
+-- ARGV[1] overwrite the new keys if "1"
+
+if redis.call('exists', KEYS[1]) == 0 then
+  return 0
+end
+if ARGV[1] ~= '1' and redis.call('exists', KEYS[8]) == 1 then
+  return -1
+end
+for i = 1, 7 do
+  if redis.call('exists', KEYS[i]) == 1 then
+    redis.call('rename', KEYS[i], KEYS[i + 7])
+  else
+    redis.call('del', KEYS[i + 7])
+  end
+end
+return 1
+`
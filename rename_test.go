@@ -0,0 +1,104 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRename(t *testing.T) {
+	t.Run("limiter.Rename should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		oldID := genID()
+		newID := genID()
+		policy := []int{2, 100, 5, 100}
+
+		assert.Equal(errNoRecord, limiter.Rename(oldID, newID))
+
+		// escalate oldID to the second tier
+		limiter.Get(oldID, policy...)
+		limiter.Get(oldID, policy...)
+		limiter.Get(oldID, policy...)
+		time.Sleep(110 * time.Millisecond)
+		res, _ := limiter.Get(oldID, policy...)
+		assert.Equal(5, res.Total)
+		assert.Nil(limiter.SetMeta(oldID, []byte("vip")))
+
+		assert.Nil(limiter.Rename(oldID, newID))
+		res, _ = limiter.Get(newID, policy...)
+		assert.Equal(5, res.Total)
+		assert.Equal(3, res.Remaining)
+		assert.Equal([]byte("vip"), res.Meta)
+
+		res, _ = limiter.Get(oldID, policy...)
+		assert.Equal(2, res.Total)
+		assert.Equal(1, res.Remaining)
+		assert.True(res.FirstWindow)
+		assert.Nil(res.Meta)
+	})
+
+	t.Run("limiter.Rename with EscalationCooldown should move the cooldown", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{EscalationCooldown: time.Second})
+		oldID := genID()
+		newID := genID()
+		policy := []int{1, 100, 5, 100, 10, 100}
+
+		limiter.Get(oldID, policy...)
+		limiter.Get(oldID, policy...)
+		assert.Nil(limiter.Rename(oldID, newID))
+
+		cooldowns := limiter.abstractLimiter.(*memoryLimiter).cooldowns
+		_, ok := cooldowns["{LIMIT:"+oldID+"}:S"]
+		assert.False(ok)
+		_, ok = cooldowns["{LIMIT:"+newID+"}:S"]
+		assert.True(ok)
+
+		// newID is in the cooldown and keeps the second tier, oldID escalates again.
+		time.Sleep(110 * time.Millisecond)
+		for i := 0; i < 6; i++ {
+			limiter.Get(newID, policy...)
+		}
+		limiter.Get(oldID, policy...)
+		limiter.Get(oldID, policy...)
+		time.Sleep(110 * time.Millisecond)
+		res, _ := limiter.Get(newID, policy...)
+		assert.Equal(5, res.Total)
+		res, _ = limiter.Get(oldID, policy...)
+		assert.Equal(5, res.Total)
+	})
+
+	t.Run("limiter.Rename to an existing id should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		oldID := genID()
+		newID := genID()
+		limiter.Get(oldID)
+		limiter.Get(oldID)
+		limiter.Get(newID)
+
+		assert.Equal(ErrIDExists, limiter.Rename(oldID, newID))
+		assert.Nil(limiter.Rename(oldID, oldID))
+
+		limiter = New(Options{RenameOverwrite: true})
+		limiter.Get(oldID)
+		limiter.Get(oldID)
+		limiter.Get(newID)
+		assert.Nil(limiter.Rename(oldID, newID))
+		res, _ := limiter.Get(newID)
+		assert.Equal(97, res.Remaining)
+	})
+
+	t.Run("limiter.Rename with sliding window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow})
+		err := limiter.Rename(genID(), genID())
+		assert.Equal("ratelimiter: rename is only supported by fixed window limiter", err.Error())
+	})
+}
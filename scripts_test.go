@@ -0,0 +1,89 @@
+package ratelimiter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisScriptLoad(t *testing.T) {
+	t.Run("redis limiter should load scripts when created", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &mockRedisClient{}
+		limiter := New(Options{Client: client})
+		loaded := len(client.commands)
+		assert.True(loaded > 0)
+		for _, command := range client.commands {
+			assert.Equal("SCRIPT LOAD", command)
+		}
+
+		res, err := limiter.Get(genID())
+		assert.Nil(err)
+		assert.Equal(9, res.Remaining)
+		assert.Equal([]string{"EVALSHA"}, client.commands[loaded:])
+	})
+
+	t.Run("redis limiters should load scripts once for a client", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &mockRedisClient{}
+		New(Options{Client: client})
+		loaded := client.loaded
+		New(Options{Client: client, Prefix: "OTHER:"})
+		New(Options{Client: client, Algorithm: SlidingWindow})
+		New(Options{Client: client, Algorithm: SlidingWindow, Prefix: "OTHER:"})
+		New(Options{Client: client, BreakerThreshold: 3})
+		assert.Equal(loaded+1, client.loaded)
+
+		limiter := New(Options{Client: client, Max: 5})
+		res, err := limiter.Get(genID())
+		assert.Nil(err)
+		assert.Equal(9, res.Remaining)
+		assert.Equal(loaded+1, client.loaded)
+
+		// another client loads the scripts for its redis, with the same sha1
+		other := &mockRedisClient{}
+		New(Options{Client: other})
+		assert.Equal(loaded, other.loaded)
+		for sha := range other.scripts {
+			assert.True(client.scripts[sha])
+		}
+		scripts.Lock()
+		for script, sha := range scripts.shas {
+			sum := sha1.Sum([]byte(script))
+			assert.Equal(hex.EncodeToString(sum[:]), sha)
+		}
+		scripts.Unlock()
+	})
+
+	t.Run("redis limiter should load a lost script again", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &mockRedisClient{}
+		limiter := New(Options{Client: client})
+		loaded := len(client.commands)
+		delete(client.scripts, scriptSha1(metaLua))
+
+		limiter.SetMeta(genID(), []byte("meta"))
+		assert.Equal([]string{"EVALSHA", "SCRIPT LOAD", "EVALSHA"}, client.commands[loaded:])
+	})
+
+	t.Run("redis limiter with LazyScriptLoad should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		client := &mockRedisClient{}
+		limiter := New(Options{Client: client, LazyScriptLoad: true})
+		assert.Equal(0, len(client.commands))
+
+		res, err := limiter.Get(genID())
+		assert.Nil(err)
+		assert.Equal(9, res.Remaining)
+		assert.Equal([]string{"EVALSHA", "SCRIPT LOAD", "EVALSHA"}, client.commands)
+
+		limiter.Get(genID())
+		assert.Equal([]string{"EVALSHA", "SCRIPT LOAD", "EVALSHA", "EVALSHA"}, client.commands)
+	})
+}
@@ -0,0 +1,212 @@
+package ratelimiter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sliding log of one key
+type slidingCacheItem struct {
+	duration time.Duration
+	log      []time.Time
+}
+
+type slidingMemoryLimiter struct {
+	max      int
+	duration time.Duration
+	store    map[string]*slidingCacheItem
+	ticker   *time.Ticker
+	lock     sync.Mutex
+	onSweep  func(stats SweepStats)
+	closed   bool
+	done     chan struct{}
+}
+
+func newSlidingMemoryLimiter(opts *Options) *slidingMemoryLimiter {
+	m := &slidingMemoryLimiter{
+		max:      opts.Max,
+		duration: opts.Duration,
+		store:    make(map[string]*slidingCacheItem),
+		onSweep:  opts.OnSweep,
+	}
+	if !opts.DisableBackgroundCleanup {
+		m.ticker = time.NewTicker(time.Second)
+		m.done = make(chan struct{})
+		go m.cleanCache()
+	}
+	return m
+}
+
+// abstractLimiter interface
+func (m *slidingMemoryLimiter) getLimit(key string, policy ...int) ([]interface{}, error) {
+	total, duration, err := slidingPolicy(m.max, m.duration, policy...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	start := now.Add(-duration)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return nil, ErrDrained
+	}
+	item, ok := m.store[key]
+	if !ok {
+		item = &slidingCacheItem{}
+		m.store[key] = item
+	}
+	item.duration = duration
+
+	// drop the requests out of the window, the same as ZREMRANGEBYSCORE.
+	i := 0
+	for i < len(item.log) && !item.log[i].After(start) {
+		i++
+	}
+	item.log = item.log[i:]
+
+	remaining := -1
+	if len(item.log) < total {
+		item.log = append(item.log, now)
+		remaining = total - len(item.log)
+	}
+
+	reset := now.Add(duration)
+	if len(item.log) > 0 {
+		reset = item.log[0].Add(duration)
+	}
+	return []interface{}{remaining, total, duration, reset}, nil
+}
+
+// abstractLimiter interface
+func (m *slidingMemoryLimiter) removeLimit(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.store, key)
+	return nil
+}
+
+func (m *slidingMemoryLimiter) clean() {
+	var stats SweepStats
+	if m.onSweep != nil {
+		begin := time.Now()
+		defer func() {
+			stats.Duration = time.Since(begin)
+			m.onSweep(stats)
+		}()
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	stats.Examined = len(m.store)
+	for key, item := range m.store {
+		if len(item.log) == 0 || !item.log[len(item.log)-1].Add(item.duration).After(now) {
+			delete(m.store, key)
+			stats.Evicted++
+		}
+	}
+}
+
+func (m *slidingMemoryLimiter) cleanCache() {
+	for {
+		select {
+		case <-m.ticker.C:
+			m.clean()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+type slidingRedisLimiter struct {
+	sha1, max, duration string
+	rc                  RedisClient
+}
+
+func newSlidingRedisLimiter(opts *Options) *slidingRedisLimiter {
+	r := &slidingRedisLimiter{
+		rc:       opts.Client,
+		sha1:     loadScript(opts, slidingLua),
+		max:      strconv.FormatInt(int64(opts.Max), 10),
+		duration: strconv.FormatInt(int64(opts.Duration/time.Millisecond), 10),
+	}
+	return r
+}
+
+// abstractLimiter interface
+func (r *slidingRedisLimiter) getLimit(key string, policy ...int) ([]interface{}, error) {
+	args := []interface{}{genTimestamp(), r.max, r.duration, genMember()}
+	if len(policy) > 0 {
+		total, duration, err := slidingPolicy(0, 0, policy...)
+		if err != nil {
+			return nil, err
+		}
+		args[1] = strconv.FormatInt(int64(total), 10)
+		args[2] = strconv.FormatInt(int64(duration/time.Millisecond), 10)
+	}
+	return evalLimit(r.rc, r.sha1, slidingLua, []string{key}, args...)
+}
+
+// abstractLimiter interface
+func (r *slidingRedisLimiter) removeLimit(key string) error {
+	return r.rc.RateDel(key)
+}
+
+// slidingPolicy returns the max count and duration for a sliding window.
+func slidingPolicy(max int, duration time.Duration, policy ...int) (int, time.Duration, error) {
+	if len(policy) == 0 {
+		return max, duration, nil
+	}
+	if len(policy) > 2 {
+		return 0, 0, errors.New("ratelimiter: sliding window supports one policy only")
+	}
+	if err := ValidatePolicy(policy...); err != nil {
+		return 0, 0, err
+	}
+	return policy[0], time.Duration(policy[1]) * time.Millisecond, nil
+}
+
+// genMember returns a unique sorted set member for one request.
+func genMember() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return genTimestamp() + ":" + hex.EncodeToString(buf)
+}
+
+// copy from ./sliding.lua
+const slidingLua string = `
+-- KEYS[1] target sorted set key
+-- ARGV[1] current timestamp, ARGV[2] max count, ARGV[3] duration, ARGV[4] member
+
+-- ZSET: KEYS[1]
+--   member: one unique member for every allowed request
+--   score: the request timestamp
+
+local now = tonumber(ARGV[1])
+local total = tonumber(ARGV[2])
+local duration = tonumber(ARGV[3])
+
+redis.call('zremrangebyscore', KEYS[1], '-inf', now - duration)
+local count = redis.call('zcard', KEYS[1])
+
+local res = {-1, total, duration, now + duration}
+if count < total then
+  redis.call('zadd', KEYS[1], now, ARGV[4])
+  res[1] = total - count - 1
+end
+redis.call('pexpire', KEYS[1], duration)
+
+local oldest = redis.call('zrange', KEYS[1], 0, 0, 'withscores')
+if oldest[2] then
+  res[4] = tonumber(oldest[2]) + duration
+end
+
+return res
+`
@@ -0,0 +1,27 @@
+-- KEYS[1] target sorted set key
+-- ARGV[1] current timestamp, ARGV[2] max count, ARGV[3] duration, ARGV[4] member
+
+-- ZSET: KEYS[1]
+--   member: one unique member for every allowed request
+--   score: the request timestamp
+
+local now = tonumber(ARGV[1])
+local total = tonumber(ARGV[2])
+local duration = tonumber(ARGV[3])
+
+redis.call('zremrangebyscore', KEYS[1], '-inf', now - duration)
+local count = redis.call('zcard', KEYS[1])
+
+local res = {-1, total, duration, now + duration}
+if count < total then
+  redis.call('zadd', KEYS[1], now, ARGV[4])
+  res[1] = total - count - 1
+end
+redis.call('pexpire', KEYS[1], duration)
+
+local oldest = redis.call('zrange', KEYS[1], 0, 0, 'withscores')
+if oldest[2] then
+  res[4] = tonumber(oldest[2]) + duration
+end
+
+return res
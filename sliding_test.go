@@ -0,0 +1,122 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingMemoryRateLimiter(t *testing.T) {
+	t.Run("ratelimiter with sliding window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow})
+		id := genID()
+
+		res, err := limiter.Get(id)
+		assert.Nil(err)
+		assert.Equal(100, res.Total)
+		assert.Equal(99, res.Remaining)
+		assert.Equal(time.Minute, res.Duration)
+		assert.True(res.Reset.After(time.Now()))
+
+		res, err = limiter.Get(id, 3, 1000)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(1, res.Remaining)
+		res, err = limiter.Get(id, 3, 1000)
+		assert.Equal(0, res.Remaining)
+		res, err = limiter.Get(id, 3, 1000)
+		assert.Equal(-1, res.Remaining)
+		res, err = limiter.Get(id, 3, 1000)
+		assert.Equal(-1, res.Remaining)
+	})
+
+	t.Run("ratelimiter with sliding window across the boundary should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow})
+		id := genID()
+		policy := []int{5, 200}
+
+		res, err := limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(4, res.Remaining)
+		first := res.Reset
+
+		// a burst at the end of the first fixed window
+		time.Sleep(150 * time.Millisecond)
+		for i := 3; i >= 0; i-- {
+			res, err = limiter.Get(id, policy...)
+			assert.Nil(err)
+			assert.Equal(i, res.Remaining)
+		}
+		assert.Equal(first, res.Reset)
+
+		// a fixed window would be reset here and allow another 5 requests,
+		// but only the first request has left the sliding window.
+		time.Sleep(60 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(0, res.Remaining)
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(-1, res.Remaining)
+		assert.True(res.Reset.After(time.Now()))
+
+		time.Sleep(200 * time.Millisecond)
+		res, err = limiter.Get(id, policy...)
+		assert.Equal(4, res.Remaining)
+	})
+
+	t.Run("ratelimiter with sliding window and Remove should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow, Max: 1})
+		id := genID()
+
+		res, _ := limiter.Get(id)
+		assert.Equal(0, res.Remaining)
+		res, _ = limiter.Get(id)
+		assert.Equal(-1, res.Remaining)
+		assert.Nil(limiter.Remove(id))
+		res, _ = limiter.Get(id)
+		assert.Equal(0, res.Remaining)
+	})
+
+	t.Run("ratelimiter with sliding window and invalid args should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow})
+		id := genID()
+		_, err := limiter.Get(id, 10)
+		assert.Equal("ratelimiter: must be paired values", err.Error())
+
+		_, err = limiter.Get(id, 10, 0)
+		assert.Equal("ratelimiter: must be positive integer", err.Error())
+
+		_, err = limiter.Get(id, 10, 100, 5, 200)
+		assert.Equal("ratelimiter: sliding window supports one policy only", err.Error())
+	})
+
+	t.Run("ratelimiter with sliding window clean should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := &slidingMemoryLimiter{
+			max:      10,
+			duration: time.Minute,
+			store:    make(map[string]*slidingCacheItem),
+			ticker:   time.NewTicker(time.Minute),
+		}
+		id := genID()
+		limiter.getLimit(id, 10, 50)
+		limiter.getLimit(genID(), 10, 1000)
+		assert.Equal(2, len(limiter.store))
+
+		time.Sleep(60 * time.Millisecond)
+		limiter.clean()
+		assert.Equal(1, len(limiter.store))
+		_, ok := limiter.store[id]
+		assert.False(ok)
+	})
+}
@@ -0,0 +1,188 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// snapshotter is implemented by limiters that can export and restore their state.
+type snapshotter interface {
+	snapshot() *memorySnapshot
+	restore(s *memorySnapshot)
+}
+
+// memorySnapshot is the serialized state of a memory limiter.
+type memorySnapshot struct {
+	Time   time.Time                 `json:"time"`
+	Store  map[string]snapshotItem   `json:"store"`
+	Status map[string]snapshotStatus `json:"status"`
+	// Cooldowns are the ends of the escalation cooldowns by status key.
+	Cooldowns map[string]time.Time `json:"cooldowns,omitempty"`
+}
+
+type snapshotItem struct {
+	Total     int           `json:"total"`
+	Remaining int           `json:"remaining"`
+	Duration  time.Duration `json:"duration"`
+	Expire    time.Time     `json:"expire"`
+	Meta      []byte        `json:"meta,omitempty"`
+	FirstSeen time.Time     `json:"firstSeen"`
+	Stats     KeyStats      `json:"stats"`
+	// LastAccess is zero in the snapshots before it was added.
+	LastAccess time.Time `json:"lastAccess"`
+	Overflow   int       `json:"overflow,omitempty"`
+	History    []int     `json:"history,omitempty"`
+	// Allowed is zero in the snapshots before it was added.
+	Allowed int `json:"allowed,omitempty"`
+}
+
+type snapshotStatus struct {
+	Index   int       `json:"index"`
+	Expire  time.Time `json:"expire"`
+	TopHits int       `json:"topHits,omitempty"`
+}
+
+// Flush writes a snapshot of the memory limiter state to Options.SnapshotWriter.
+// Every snapshot is a single JSON document followed by a newline,
+// so a writer can receive many snapshots and RestoreFrom uses the last one.
+// The limiter also flushes periodically when Options.SnapshotInterval is set.
+func (l *Limiter) Flush() error {
+	if l.snapshotWriter == nil {
+		return errors.New("ratelimiter: no snapshot writer")
+	}
+	s, ok := l.abstractLimiter.(snapshotter)
+	if !ok {
+		return errors.New("ratelimiter: snapshot is only supported by memory limiter")
+	}
+	data, err := json.Marshal(s.snapshot())
+	if err != nil {
+		return err
+	}
+
+	l.snapshotLock.Lock()
+	defer l.snapshotLock.Unlock()
+	_, err = l.snapshotWriter.Write(append(data, '\n'))
+	return err
+}
+
+// RestoreFrom restores the memory limiter state from the last snapshot in r,
+// records that have expired since the snapshot are skipped.
+// The requests after the last snapshot are lost, so a restored limiter may allow
+// up to Options.SnapshotInterval more requests than it should.
+func (l *Limiter) RestoreFrom(r io.Reader) error {
+	s, ok := l.abstractLimiter.(snapshotter)
+	if !ok {
+		return errors.New("ratelimiter: snapshot is only supported by memory limiter")
+	}
+
+	var last *memorySnapshot
+	decoder := json.NewDecoder(r)
+	for {
+		snap := &memorySnapshot{}
+		err := decoder.Decode(snap)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		last = snap
+	}
+	if last == nil {
+		return errors.New("ratelimiter: no snapshot found")
+	}
+	s.restore(last)
+	return nil
+}
+
+// snapshotLoop flushes every interval until Close, it closes l.snapshotStopped when it returns.
+func (l *Limiter) snapshotLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(l.snapshotStopped)
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.Flush(); err != nil {
+				log.Printf("ratelimiter: snapshot failed: %v", err)
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// snapshotter interface
+func (m *memoryLimiter) snapshot() *memorySnapshot {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s := &memorySnapshot{
+		Time:   time.Now(),
+		Store:  make(map[string]snapshotItem, len(m.store)),
+		Status: make(map[string]snapshotStatus, len(m.status)),
+
+		Cooldowns: make(map[string]time.Time, len(m.cooldowns)),
+	}
+	for key, item := range m.store {
+		s.Store[key] = snapshotItem{
+			Total:      item.total,
+			Remaining:  item.remaining,
+			Duration:   item.duration,
+			Expire:     item.expire,
+			Meta:       item.meta,
+			FirstSeen:  item.firstSeen,
+			Stats:      item.stats,
+			LastAccess: item.lastAccess,
+			Overflow:   item.overflow,
+			Allowed:    item.allowed,
+			// the history is copied, as it is marshaled after the lock is released.
+			History: append([]int(nil), item.history...),
+		}
+	}
+	for key, item := range m.status {
+		s.Status[key] = snapshotStatus{Index: item.index, Expire: item.expire, TopHits: item.topHits}
+	}
+	for key, until := range m.cooldowns {
+		s.Cooldowns[key] = until
+	}
+	return s
+}
+
+// snapshotter interface
+func (m *memoryLimiter) restore(s *memorySnapshot) {
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key, item := range s.Store {
+		if item.Expire.Add(item.Duration).Before(now) {
+			continue
+		}
+		m.store[key] = &limiterCacheItem{
+			total:      item.Total,
+			remaining:  item.Remaining,
+			duration:   item.Duration,
+			expire:     item.Expire,
+			meta:       item.Meta,
+			firstSeen:  item.FirstSeen,
+			stats:      item.Stats,
+			lastAccess: item.LastAccess,
+			overflow:   item.Overflow,
+			allowed:    item.Allowed,
+			history:    item.History,
+		}
+	}
+	for key, item := range s.Status {
+		if item.Expire.Before(now) {
+			continue
+		}
+		m.status[key] = &statusCacheItem{index: item.Index, expire: item.Expire, topHits: item.TopHits}
+	}
+	for key, until := range s.Cooldowns {
+		if until.After(now) {
+			m.cooldowns[key] = until
+		}
+	}
+}
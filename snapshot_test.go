@@ -0,0 +1,159 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type snapshotBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *snapshotBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *snapshotBuffer) Bytes() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]byte{}, b.buf.Bytes()...)
+}
+
+type failedWriter struct{}
+
+func (failedWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	t.Run("limiter.Flush and limiter.RestoreFrom should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		limiter := New(Options{SnapshotWriter: &buf})
+		id := genID()
+		policy := []int{3, 1000, 2, 2000}
+
+		limiter.Get(id, policy...)
+		limiter.Get(id, policy...)
+		assert.Nil(limiter.Flush())
+		limiter.Get(id, policy...)
+		assert.Nil(limiter.Flush())
+
+		restored := New(Options{})
+		assert.Nil(restored.RestoreFrom(bytes.NewReader(buf.Bytes())))
+		res, err := restored.Get(id, policy...)
+		assert.Nil(err)
+		assert.Equal(3, res.Total)
+		assert.Equal(-1, res.Remaining)
+
+		res, err = restored.Get(genID(), policy...)
+		assert.Nil(err)
+		assert.Equal(2, res.Remaining)
+	})
+
+	t.Run("limiter.RestoreFrom should restore overflow, history and cooldown", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		opts := Options{SnapshotWriter: &buf, WindowHistorySize: 2, EscalationCooldown: time.Second}
+		limiter := New(opts)
+		id := genID()
+		policy := []int{2, 100, 5, 100}
+
+		// escalate to the second tier, then go over its limit twice in the cooldown.
+		for i := 0; i < 3; i++ {
+			limiter.Get(id, policy...)
+		}
+		time.Sleep(110 * time.Millisecond)
+		for i := 0; i < 7; i++ {
+			limiter.Get(id, policy...)
+		}
+		assert.Nil(limiter.Flush())
+
+		restored := New(Options{})
+		assert.Nil(restored.RestoreFrom(&buf))
+		key := "LIMIT:" + id
+		statusKey := "{" + key + "}:S"
+		from := limiter.abstractLimiter.(*memoryLimiter)
+		to := restored.abstractLimiter.(*memoryLimiter)
+		assert.Equal(2, to.store[key].overflow)
+		assert.Equal(from.store[key].history, to.store[key].history)
+		assert.Equal(1, len(to.store[key].history))
+		assert.True(from.cooldowns[statusKey].Equal(to.cooldowns[statusKey]))
+	})
+
+	t.Run("limiter with SnapshotInterval should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		buf := &snapshotBuffer{}
+		limiter := New(Options{SnapshotWriter: buf, SnapshotInterval: 20 * time.Millisecond})
+		id := genID()
+		for i := 0; i < 5; i++ {
+			limiter.Get(id, 10, 1000)
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		restored := New(Options{})
+		assert.Nil(restored.RestoreFrom(bytes.NewReader(buf.Bytes())))
+		res, err := restored.Get(id, 10, 1000)
+		assert.Nil(err)
+		assert.Equal(4, res.Remaining)
+	})
+
+	t.Run("limiter with SnapshotInterval and no snapshot should not start the snapshot loop", func(t *testing.T) {
+		assert := assert.New(t)
+
+		buf := &snapshotBuffer{}
+		limiter := New(Options{SnapshotWriter: buf, SnapshotInterval: time.Millisecond, Algorithm: SlidingWindow})
+		assert.Nil(limiter.snapshotStopped)
+		time.Sleep(5 * time.Millisecond)
+		assert.Equal(0, len(buf.Bytes()))
+		assert.Nil(limiter.Close())
+	})
+
+	t.Run("limiter.RestoreFrom with expired records should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var buf bytes.Buffer
+		limiter := New(Options{SnapshotWriter: &buf})
+		id := genID()
+		limiter.Get(id, 10, 50)
+		assert.Nil(limiter.Flush())
+
+		time.Sleep(120 * time.Millisecond)
+		restored := New(Options{})
+		assert.Nil(restored.RestoreFrom(&buf))
+		res, _ := restored.Get(id, 10, 50)
+		assert.Equal(9, res.Remaining)
+	})
+
+	t.Run("limiter.Flush with errors should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		assert.Equal("ratelimiter: no snapshot writer", limiter.Flush().Error())
+
+		limiter = New(Options{SnapshotWriter: failedWriter{}, SnapshotInterval: time.Millisecond})
+		assert.Equal("disk full", limiter.Flush().Error())
+		time.Sleep(5 * time.Millisecond)
+		assert.Equal("disk full", limiter.Close().Error())
+
+		limiter = New(Options{SnapshotWriter: &bytes.Buffer{}, Algorithm: SlidingWindow})
+		assert.Equal("ratelimiter: snapshot is only supported by memory limiter", limiter.Flush().Error())
+		err := limiter.RestoreFrom(&bytes.Buffer{})
+		assert.Equal("ratelimiter: snapshot is only supported by memory limiter", err.Error())
+
+		limiter = New(Options{})
+		assert.Equal("ratelimiter: no snapshot found", limiter.RestoreFrom(&bytes.Buffer{}).Error())
+		assert.Error(limiter.RestoreFrom(bytes.NewBufferString("{")))
+	})
+}
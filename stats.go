@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"errors"
+	"time"
+)
+
+// KeyStats is the cumulative statistics of an id since its limit record was created.
+// It is reset when the record is removed by Remove or expires.
+type KeyStats struct {
+	Allowed     int `json:"allowed"`     // The count of allowed requests
+	Denied      int `json:"denied"`      // The count of denied requests
+	Escalations int `json:"escalations"` // The count of multi-policy escalations
+	Rollovers   int `json:"rollovers"`   // The count of window resets
+}
+
+type statsReader interface {
+	keyStats(key string) (KeyStats, bool)
+}
+
+// KeyStats returns the statistics of id, and false if id has no limit record.
+// It costs a few ints per id, and it is supported by the memory fixed window limiter only:
+// the redis limiter keeps no stats hash for an id, and it returns an error.
+func (l *Limiter) KeyStats(id string) (KeyStats, bool, error) {
+	s, ok := l.abstractLimiter.(statsReader)
+	if !ok {
+		return KeyStats{}, false, errors.New("ratelimiter: key stats is only supported by memory limiter")
+	}
+	stats, ok := s.keyStats(l.prefix + id)
+	return stats, ok, nil
+}
+
+// statsReader interface
+func (m *memoryLimiter) keyStats(key string) (KeyStats, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.store[key]
+	if !ok {
+		return KeyStats{}, false
+	}
+	return item.stats, true
+}
+
+type rateReader interface {
+	currentRate(key string) float64
+}
+
+// CurrentRate returns an estimate of the requests per second of id right now, that is
+// the allowed requests in the current window divided by the time since the window started.
+// It resets with every window, and it is 0 if id has no live window or the window has just started
+// (less than a millisecond ago). It is supported by the memory fixed window limiter only.
+func (l *Limiter) CurrentRate(id string) (float64, error) {
+	r, ok := l.abstractLimiter.(rateReader)
+	if !ok {
+		return 0, errors.New("ratelimiter: current rate is only supported by memory limiter")
+	}
+	return r.currentRate(l.prefix + id), nil
+}
+
+// rateReader interface
+func (m *memoryLimiter) currentRate(key string) float64 {
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.store[key]
+	if !ok || !item.expire.After(now) {
+		return 0
+	}
+	elapsed := now.Sub(item.expire.Add(-item.duration))
+	if elapsed < time.Millisecond {
+		return 0
+	}
+	return float64(item.allowed) / elapsed.Seconds()
+}
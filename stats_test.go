@@ -0,0 +1,101 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryKeyStats(t *testing.T) {
+	t.Run("limiter.KeyStats should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+		policy := []int{2, 100, 1, 100}
+
+		_, ok, err := limiter.KeyStats(id)
+		assert.Nil(err)
+		assert.False(ok)
+
+		// 2 allowed, 2 denied and 1 escalation
+		for i := 0; i < 4; i++ {
+			limiter.Get(id, policy...)
+		}
+		stats, ok, err := limiter.KeyStats(id)
+		assert.Nil(err)
+		assert.True(ok)
+		assert.Equal(KeyStats{Allowed: 2, Denied: 2, Escalations: 1}, stats)
+
+		// the last tier: 1 allowed, 1 denied and no escalation
+		time.Sleep(100*time.Millisecond + time.Millisecond)
+		res, _ := limiter.Get(id, policy...)
+		assert.Equal(1, res.Total)
+		limiter.Get(id, policy...)
+		stats, _, _ = limiter.KeyStats(id)
+		assert.Equal(KeyStats{Allowed: 3, Denied: 3, Escalations: 1, Rollovers: 1}, stats)
+
+		// more used-up windows at the last tier are no escalation
+		for i := 0; i < 2; i++ {
+			time.Sleep(100*time.Millisecond + time.Millisecond)
+			limiter.Get(id, policy...)
+			limiter.Get(id, policy...)
+		}
+		stats, _, _ = limiter.KeyStats(id)
+		assert.Equal(KeyStats{Allowed: 5, Denied: 5, Escalations: 1, Rollovers: 3}, stats)
+
+		limiter.Remove(id)
+		_, ok, _ = limiter.KeyStats(id)
+		assert.False(ok)
+		limiter.Get(id, policy...)
+		stats, _, _ = limiter.KeyStats(id)
+		assert.Equal(KeyStats{Allowed: 1}, stats)
+	})
+
+	t.Run("limiter.KeyStats with sliding window should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Algorithm: SlidingWindow})
+		_, ok, err := limiter.KeyStats(genID())
+		assert.False(ok)
+		assert.Equal("ratelimiter: key stats is only supported by memory limiter", err.Error())
+	})
+}
+
+func TestMemoryCurrentRate(t *testing.T) {
+	t.Run("limiter.CurrentRate should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		id := genID()
+
+		rate, err := limiter.CurrentRate(id)
+		assert.Nil(err)
+		assert.Equal(0.0, rate)
+
+		for i := 0; i < 10; i++ {
+			limiter.Get(id)
+		}
+		time.Sleep(100 * time.Millisecond)
+		rate, err = limiter.CurrentRate(id)
+		assert.Nil(err)
+		assert.InDelta(100, rate, 20)
+
+		// it resets with the window
+		id = genID()
+		limiter.Get(id, 5, 50)
+		limiter.Get(id, 5, 50)
+		time.Sleep(60 * time.Millisecond)
+		rate, _ = limiter.CurrentRate(id)
+		assert.Equal(0.0, rate)
+	})
+
+	t.Run("limiter.CurrentRate with redis should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{Client: &mockRedisClient{}})
+		_, err := limiter.CurrentRate(genID())
+		assert.Equal("ratelimiter: current rate is only supported by memory limiter", err.Error())
+	})
+}
@@ -0,0 +1,59 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type policyStore interface {
+	setPolicy(key string, max int, duration time.Duration) error
+	clearPolicy(key string) error
+}
+
+// SetPolicy stores the policy of id in redis, so a bare Get(id) without policy uses max and duration
+// instead of Options.Max and Options.Duration, on every server sharing the redis. A Get with a policy
+// ignores the stored one, and so does a bare Get of a limiter with Options.AdaptiveLatencyTarget.
+// The stored policy never expires and Remove keeps it, ClearPolicy deletes it. It applies from the next window of id.
+// It is supported by the redis fixed window limiter only.
+func (l *Limiter) SetPolicy(id string, max int, duration time.Duration) error {
+	s, ok := l.abstractLimiter.(policyStore)
+	if !ok {
+		return errors.New("ratelimiter: stored policy is only supported by redis limiter")
+	}
+	if err := ValidatePolicy(max, int(duration/time.Millisecond)); err != nil {
+		return err
+	}
+	return s.setPolicy(l.prefix+id, max, duration)
+}
+
+// ClearPolicy deletes the stored policy of id, a bare Get(id) uses Options.Max and Options.Duration
+// again from the next window of id. It is supported by the redis fixed window limiter only.
+func (l *Limiter) ClearPolicy(id string) error {
+	s, ok := l.abstractLimiter.(policyStore)
+	if !ok {
+		return errors.New("ratelimiter: stored policy is only supported by redis limiter")
+	}
+	return s.clearPolicy(l.prefix + id)
+}
+
+// policyStore interface
+func (r *redisLimiter) setPolicy(key string, max int, duration time.Duration) error {
+	keys := []string{fmt.Sprintf("{%s}:P", key)}
+	_, err := evalScript(r.rc, r.setPolicySha1, setPolicyLua, keys,
+		strconv.FormatInt(int64(max), 10), strconv.FormatInt(int64(duration/time.Millisecond), 10))
+	return err
+}
+
+// policyStore interface
+func (r *redisLimiter) clearPolicy(key string) error {
+	return r.rc.RateDel(fmt.Sprintf("{%s}:P", key))
+}
+
+const setPolicyLua string = `
+-- KEYS[1] target stored policy hash key
+-- ARGV[1] max count, ARGV[2] duration
+
+return redis.call('hmset', KEYS[1], 'mx', ARGV[1], 'dn', ARGV[2])
+`
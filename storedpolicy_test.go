@@ -0,0 +1,58 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoredPolicy(t *testing.T) {
+	t.Run("limiter.SetPolicy should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		assert.Equal("ratelimiter: stored policy is only supported by redis limiter", limiter.SetPolicy(genID(), 3, time.Second).Error())
+
+		client := &mockRedisClient{}
+		limiter = New(Options{Client: client})
+		loaded := len(client.commands)
+		assert.Equal("ratelimiter: must be positive integer", limiter.SetPolicy(genID(), 0, time.Second).Error())
+		assert.Equal("ratelimiter: must be positive integer", limiter.SetPolicy(genID(), 3, time.Microsecond).Error())
+		assert.Equal(loaded, len(client.commands))
+		assert.Nil(limiter.SetPolicy(genID(), 3, time.Second))
+		assert.Equal([]string{"EVALSHA"}, client.commands[loaded:])
+	})
+
+	t.Run("limiter.ClearPolicy should be", func(t *testing.T) {
+		assert := assert.New(t)
+
+		limiter := New(Options{})
+		assert.Equal("ratelimiter: stored policy is only supported by redis limiter", limiter.ClearPolicy(genID()).Error())
+
+		client := &mockRedisClient{}
+		limiter = New(Options{Client: client, Prefix: "P:"})
+		assert.Nil(limiter.ClearPolicy("id"))
+		assert.Equal([]string{"{P:id}:P"}, client.deleted)
+	})
+
+	t.Run("redis limiter should flag a bare Get for the stored policy", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r := newRedisLimiter(&Options{Client: &mockRedisClient{}, Max: 10, Duration: time.Second})
+		keys, args, err := r.limitArgs("id")
+		assert.Nil(err)
+		assert.Equal("{id}:P", keys[5])
+		assert.Equal("1", args[len(args)-1])
+
+		keys, args, err = r.limitArgs("id", 10, 1000)
+		assert.Nil(err)
+		assert.Equal("{id}:P", keys[5])
+		assert.Equal("0", args[len(args)-1])
+
+		_, args, err = r.limitArgs("id", 10, 1000, 2, 2000)
+		assert.Nil(err)
+		assert.Equal(9, len(args))
+		assert.Equal("0", args[len(args)-1])
+	})
+}